@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/migrate"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewMigrateCommand creates migrate up|down|status|create for migrations embedded in fsys
+// dir is the source dir of fsys, new migrations are created there
+func NewMigrateCommand(fsys fs.FS, dir string) *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate database schema",
+		Long:  `Apply, revert & list versioned sql migrations tracked in the migrations table`,
+	}
+
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigrator(cmd.Context(), fsys, func(ctx context.Context, m *migrate.Migrator) error {
+				applied, err := m.Up(ctx)
+				for _, migration := range applied {
+					fmt.Fprintf(cmd.OutOrStdout(), "applied %d_%s\n", migration.Version, migration.Name)
+				}
+				return err
+			})
+		},
+	}
+
+	downCmd := &cobra.Command{
+		Use:   "down [steps]",
+		Short: "Revert the last applied migrations, 1 by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return errors.New("steps must be a positive number")
+				}
+				steps = n
+			}
+			return runMigrator(cmd.Context(), fsys, func(ctx context.Context, m *migrate.Migrator) error {
+				reverted, err := m.Down(ctx, steps)
+				for _, migration := range reverted {
+					fmt.Fprintf(cmd.OutOrStdout(), "reverted %d_%s\n", migration.Version, migration.Name)
+				}
+				return err
+			})
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "List migrations w applied state",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigrator(cmd.Context(), fsys, func(ctx context.Context, m *migrate.Migrator) error {
+				statuses, err := m.Status(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+				for _, s := range statuses {
+					appliedAt := "pending"
+					if s.Applied {
+						appliedAt = s.AppliedAt.Format(time.RFC3339)
+					}
+					if s.Modified {
+						appliedAt += " (modified)"
+					}
+					fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				return migrate.Verify(statuses)
+			})
+		},
+	}
+
+	var createDir string
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create empty up & down migration files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := migrate.Create(createDir, args[0], time.Now())
+			for _, file := range files {
+				fmt.Fprintf(cmd.OutOrStdout(), "created %s\n", file)
+			}
+			return err
+		},
+	}
+	createCmd.Flags().StringVar(&createDir, "dir", dir, "migrations directory")
+
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd, createCmd)
+	return migrateCmd
+}
+
+// runMigrator connects the configured database & runs fn
+func runMigrator(ctx context.Context, fsys fs.FS, fn func(ctx context.Context, m *migrate.Migrator) error) error {
+	if cfgs.Database == nil {
+		return errors.New("missing database config")
+	}
+	// migrations are postgres sql & locking, other drivers use autoMigrate
+	if driver := cfgs.Database.Driver; driver != "" && driver != dal.DriverPostgres {
+		return fmt.Errorf("migrate: driver %q not supported, use autoMigrate", driver)
+	}
+	store, err := dal.NewDataAccessLayer(ctx, cfgs.Database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := store.Disconnect(); err != nil {
+			log.Error("Close db failed", zap.Error(err))
+		}
+	}()
+	db, err := store.GetDatabase().DB()
+	if err != nil {
+		return err
+	}
+	m, err := migrate.New(db, fsys, migrate.WithTable(cfgs.Database.MigrationsTable))
+	if err != nil {
+		return err
+	}
+	return fn(ctx, m)
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"errors"
 	"net"
 	"strconv"
 
@@ -35,10 +34,11 @@ func ClientService() error {
 	// logger := log.NewFactory(zapLogger)
 
 	//
-	managerClient := bridge.NewManagerClientWithConfigs(cfgs.ManagerClient)
-	if managerClient == nil {
-		return logError(zapLogger, errors.New("create new manager client failed"))
+	managerClient, err := bridge.NewEchoManager(cfgs.ManagerClient)
+	if err != nil {
+		return logError(zapLogger, err)
 	}
+	defer managerClient.Close()
 
 	addr := net.JoinHostPort(cfgs.GRPC.Host, strconv.Itoa(cfgs.GRPC.Port))
 	client, err := managerClient.GetClient(addr)
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
+
 	grpcClient "github.com/1412335/grpc-rest-microservice/pkg/client"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	pkgServer "github.com/1412335/grpc-rest-microservice/pkg/server"
 	v3 "github.com/1412335/grpc-rest-microservice/service/v3"
 	"github.com/1412335/grpc-rest-microservice/service/v3/client"
 	"github.com/1412335/grpc-rest-microservice/service/v3/handler"
@@ -32,6 +35,18 @@ func V3Service() error {
 	// set default logger
 	// v3.DefaultLogger = zapLogger
 
+	// grpc + gateway on a single port
+	if cfgs.EnableMultiplex {
+		server := v3.NewServer(
+			cfgs,
+			pkgServer.WithGateway(handler.NewProxy(cfgs)),
+		)
+		if server == nil {
+			return logError(zapLogger, errors.New("create server failed"))
+		}
+		return logError(zapLogger, server.Run())
+	}
+
 	// server
 	server := v3.NewServer(
 		cfgs,
@@ -1,7 +1,11 @@
 package main
 
-import "github.com/1412335/grpc-rest-microservice/cmd"
+import (
+	"github.com/1412335/grpc-rest-microservice/cmd"
+	"github.com/1412335/grpc-rest-microservice/service/v3/migrations"
+)
 
 func main() {
+	cmd.AddCommand(cmd.NewMigrateCommand(migrations.FS, "service/v3/migrations"))
 	cmd.Execute()
 }
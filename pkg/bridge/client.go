@@ -4,11 +4,12 @@ import (
 	"context"
 	"io"
 	"log"
+	"sync"
 	"time"
 
 	api_v2 "github.com/1412335/grpc-rest-microservice/pkg/api/v2/grpc-gateway/gen"
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 
-	grpcpool "github.com/processout/grpc-go-pool"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -26,12 +27,83 @@ type Client interface {
 
 type ClientImpl struct {
 	client   api_v2.ServiceExtraClient
-	conn     *grpcpool.ClientConn
+	conn     *PooledClient
 	ctx      context.Context
 	username string
 	password string
 }
 
+// EchoManager hands out api v2 echo clients from pooled connections
+// requests to authMethods carry jwt token got by Login
+type EchoManager struct {
+	manager         ManagerClient
+	interceptor     *SimpleClientInterceptor
+	authentication  *configs.Authentication
+	refreshDuration time.Duration
+	authMethods     map[string]bool
+
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// new echo client manager with bridge configs
+func NewEchoManager(config *configs.ManagerClient) (*EchoManager, error) {
+	interceptor := NewSimpleClientInterceptor(config.AuthMethods)
+	manager, err := NewManagerClient(config, func(cc grpc.ClientConnInterface) interface{} {
+		return api_v2.NewServiceExtraClient(cc)
+	}, WithInterceptors(interceptor))
+	if err != nil {
+		return nil, err
+	}
+	authentication := config.Authentication
+	if authentication == nil {
+		authentication = &configs.Authentication{}
+	}
+	return &EchoManager{
+		manager:         manager,
+		interceptor:     interceptor,
+		authentication:  authentication,
+		refreshDuration: config.RefreshDuration,
+		authMethods:     config.AuthMethods,
+	}, nil
+}
+
+func (e *EchoManager) GetClient(host string) (Client, error) {
+	ctx := context.Background()
+	conn, err := e.manager.GetClient(ctx, host)
+	if err != nil {
+		log.Printf("[Echo Manager] Get client with host '%v' error %+v\n", host, err)
+		return nil, err
+	}
+	client := &ClientImpl{
+		client:   conn.Client.(api_v2.ServiceExtraClient),
+		conn:     conn,
+		ctx:      ctx,
+		username: e.authentication.Username,
+		password: e.authentication.Password,
+	}
+
+	// login once & refresh jwt token in background
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.loggedIn {
+		if err := e.interceptor.Load(client, e.authMethods, e.refreshDuration); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		e.loggedIn = true
+	}
+	return client, nil
+}
+
+func (e *EchoManager) Stats() map[string]PoolStats {
+	return e.manager.Stats()
+}
+
+func (e *EchoManager) Close() {
+	e.manager.Close()
+}
+
 func (c *ClientImpl) Close() error {
 	return c.conn.Close()
 }
@@ -3,269 +3,301 @@ package bridge
 import (
 	"context"
 	"errors"
+	"log"
+	"sync"
 	"time"
 
-	api_v2 "github.com/1412335/grpc-rest-microservice/pkg/api/v2/grpc-gateway/gen"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 
-	"log"
-
-	cmap "github.com/orcaman/concurrent-map"
-	grpcpool "github.com/processout/grpc-go-pool"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
-	IDLE             = "IDLE"
-	CONNECTING       = "CONNECTING"
-	READY            = "READY"
-	TRANSIENTFAILURE = "TRANSIENT_FAILURE"
-	SHUTDOWN         = "SHUTDOWN"
-	INVALID          = "Invalid-State"
+	defaultPoolSize    = 5
+	defaultIdleTimeout = 60 * time.Second
+
+	defaultProbeInterval   = 30 * time.Second
+	defaultProbeTimeout    = 3 * time.Second
+	defaultProbeMaxBackoff = 5 * time.Minute
 )
 
+// NewClientFunc creates a service stub on a pooled connection, eg. api_v2.NewServiceExtraClient
+type NewClientFunc func(cc grpc.ClientConnInterface) interface{}
+
+// ManagerClient pools grpc connections per host & hands out service stubs
 type ManagerClient interface {
-	GetClient(host string) (Client, error)
+	// GetClient returns a stub on a pooled connection to host, Close returns the connection to the pool
+	GetClient(ctx context.Context, host string) (*PooledClient, error)
+	// Stats returns pool usage per host
+	Stats() map[string]PoolStats
 	Close()
 }
 
-type ManagerClientImpl struct {
-	maxPoolSize int
-	timeOut     int
-	poolClients cmap.ConcurrentMap
-	interceptor ClientInterceptor
-
-	// method need to request with authentication
-	authMethods map[string]bool
+// PooledClient is a service stub bound to a pooled connection
+type PooledClient struct {
+	// Client is the stub created by NewClientFunc
+	Client interface{}
+	Host   string
+	conn   *pooledConn
+}
 
-	// jwt token
-	refreshDuration time.Duration
+// Close returns connection to the pool
+func (c *PooledClient) Close() error {
+	return c.conn.pool.put(c.conn)
+}
 
-	// credentials auth
-	authentication *configs.Authentication
+// PoolStats is the usage of a host pool
+type PoolStats struct {
+	Capacity  int
+	Available int
+	InUse     int
+	// open connections, idle & in use
+	Open int
+	// connections handed out & failures (pool exhausted, broken connections)
+	Requests uint64
+	Errors   uint64
+	// connections closed by health probes, idle timeout or broken at checkout
+	Evictions uint64
 }
 
-type PoolClient struct {
-	// interceptor ClientInterceptor
-	pool     *grpcpool.Pool
-	host     string
-	username string
-	password string
+type Option func(*managerClient)
+
+// WithPerRPCCredentials attaches credentials to every request, eg. utils.Authentication
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return func(m *managerClient) {
+		m.perRPCCreds = creds
+	}
 }
 
-func NewManagerClient(maxPoolSize, timeOut int) ManagerClient {
-	return &ManagerClientImpl{
-		maxPoolSize: maxPoolSize,
-		timeOut:     timeOut,
-		poolClients: cmap.New(),
+// WithInterceptors chains client interceptors, eg. jwt token interceptor
+func WithInterceptors(interceptors ...ClientInterceptor) Option {
+	return func(m *managerClient) {
+		m.interceptors = append(m.interceptors, interceptors...)
 	}
 }
 
-// new manager client with bridge configs
-func NewManagerClientWithConfigs(config *configs.ManagerClient) ManagerClient {
-	return &ManagerClientImpl{
-		maxPoolSize:     config.MaxPoolSize,
-		timeOut:         config.TimeOut,
-		poolClients:     cmap.New(),
-		authMethods:     config.AuthMethods,
-		refreshDuration: config.RefreshDuration,
-		authentication:  config.Authentication,
+// WithDialOptions appends grpc dial options of pooled connections
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(m *managerClient) {
+		m.dialOptions = append(m.dialOptions, opts...)
 	}
 }
 
-// func (poolClient *PoolClient) newFactoryClient() (*grpc.ClientConn, error) {
-// 	clientInterceptor := poolClient.interceptor
-// 	if clientInterceptor == nil {
-// 		clientInterceptor = &SimpleClientInterceptor{}
-// 		poolClient.interceptor = clientInterceptor
-// 	}
-// 	conn, err := grpc.Dial(
-// 		poolClient.host,
-// 		grpc.WithInsecure(),
-// 		grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
-// 		grpc.WithStreamInterceptor(clientInterceptor.Stream()),
-// 	)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return conn, nil
-// }
+type managerClient struct {
+	newClient    NewClientFunc
+	poolSize     int
+	idleTimeout  time.Duration
+	creds        credentials.TransportCredentials
+	perRPCCreds  credentials.PerRPCCredentials
+	interceptors []ClientInterceptor
+	dialOptions  []grpc.DialOption
+
+	// health prober
+	probeInterval   time.Duration
+	probeTimeout    time.Duration
+	probeMaxBackoff time.Duration
+	stop            chan struct{}
+	done            chan struct{}
+
+	metrics *poolMetrics
+
+	mu    sync.Mutex
+	pools map[string]*connPool
+}
 
-// // new factory client with interceptor
-// func (poolClient *PoolClient) newFactoryClientWithInterceptor(clientInterceptor ClientInterceptor) func() (*grpc.ClientConn, error) {
-// 	return func() (*grpc.ClientConn, error) {
-// 		conn, err := grpc.Dial(
-// 			poolClient.host,
-// 			grpc.WithInsecure(),
-// 			grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
-// 			grpc.WithStreamInterceptor(clientInterceptor.Stream()),
-// 		)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		return conn, nil
-// 	}
-// }
+var _ ManagerClient = (*managerClient)(nil)
 
-// factory client with credentials
-func (poolClient *PoolClient) newFactoryClientWithCredentials(clientInterceptor ClientInterceptor) func() (*grpc.ClientConn, error) {
-	return func() (*grpc.ClientConn, error) {
-		auth := utils.Authentication{
-			Username: poolClient.username,
-			Password: poolClient.password,
+// NewManagerClient creates pools w size, idle timeout, credentials & tls from config
+func NewManagerClient(config *configs.ManagerClient, newClient NewClientFunc, opt ...Option) (ManagerClient, error) {
+	if newClient == nil {
+		return nil, errors.New("bridge: missing client constructor")
+	}
+	m := &managerClient{
+		newClient:       newClient,
+		poolSize:        defaultPoolSize,
+		idleTimeout:     defaultIdleTimeout,
+		probeInterval:   defaultProbeInterval,
+		probeTimeout:    defaultProbeTimeout,
+		probeMaxBackoff: defaultProbeMaxBackoff,
+		metrics:         newPoolMetrics(),
+		pools:           make(map[string]*connPool),
+	}
+	if config != nil {
+		if config.MaxPoolSize > 0 {
+			m.poolSize = config.MaxPoolSize
 		}
-		conn, err := grpc.Dial(
-			poolClient.host,
-			grpc.WithInsecure(),
-			grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
-			grpc.WithStreamInterceptor(clientInterceptor.Stream()),
-			grpc.WithPerRPCCredentials(&auth),
-		)
-		if err != nil {
-			return nil, err
+		if config.TimeOut > 0 {
+			m.idleTimeout = time.Duration(config.TimeOut) * time.Second
+		}
+		// credentials auth
+		if config.Authentication != nil {
+			m.perRPCCreds = &utils.Authentication{
+				Username: config.Authentication.Username,
+				Password: config.Authentication.Password,
+			}
+		}
+		// tls w optional client certificate (mTLS)
+		if config.EnableTLS && config.TLSCert != nil {
+			tlsConfig, err := utils.LoadClientTLSConfigWithCert(config.TLSCert.CACert, config.TLSCert.CertPem, config.TLSCert.KeyPem)
+			if err != nil {
+				return nil, err
+			}
+			m.creds = credentials.NewTLS(tlsConfig)
+		}
+		if hc := config.HealthCheck; hc != nil {
+			if hc.Interval != 0 {
+				m.probeInterval = hc.Interval
+			}
+			if hc.Timeout > 0 {
+				m.probeTimeout = hc.Timeout
+			}
+			if hc.MaxBackoff > 0 {
+				m.probeMaxBackoff = hc.MaxBackoff
+			}
 		}
-		return conn, nil
 	}
-}
-
-func (poolClient *PoolClient) newClient() (Client, error) {
-	ctx := context.Background()
-
-	conn, err := poolClient.pool.Get(ctx)
-	if err != nil {
-		return nil, err
+	for _, o := range opt {
+		o(m)
 	}
-
-	// check status conn
-	state := conn.GetState().String()
-	log.Println("[PoolClient] State connection: " + state)
-	if state == TRANSIENTFAILURE || state == SHUTDOWN || state == INVALID {
-		return nil, errors.New("pool connection failed")
+	if m.probeInterval > 0 {
+		m.stop, m.done = make(chan struct{}), make(chan struct{})
+		go m.prober()
 	}
-
-	return &ClientImpl{
-		client:   api_v2.NewServiceExtraClient(conn.ClientConn),
-		conn:     conn,
-		ctx:      ctx,
-		username: poolClient.username,
-		password: poolClient.password,
-	}, nil
+	return m, nil
 }
 
-func (poolClient *PoolClient) closePool() {
-	poolClient.pool.Close()
-}
-
-func (managerClient *ManagerClientImpl) loadInterceptor() {
-	if managerClient.interceptor == nil {
-		interceptor := &SimpleClientInterceptor{}
-		managerClient.interceptor = interceptor
+// factory of pooled connections to host
+func (m *managerClient) factory(host string) func() (*grpc.ClientConn, error) {
+	return func() (*grpc.ClientConn, error) {
+		opts := []grpc.DialOption{grpc.WithInsecure()}
+		if m.creds != nil {
+			opts = []grpc.DialOption{grpc.WithTransportCredentials(m.creds)}
+		}
+		if m.perRPCCreds != nil {
+			opts = append(opts, grpc.WithPerRPCCredentials(m.perRPCCreds))
+		}
+		var unaryInterceptors []grpc.UnaryClientInterceptor
+		var streamInterceptors []grpc.StreamClientInterceptor
+		for _, i := range m.interceptors {
+			unaryInterceptors = append(unaryInterceptors, i.Unary())
+			streamInterceptors = append(streamInterceptors, i.Stream())
+		}
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+			grpc.WithChainStreamInterceptor(streamInterceptors...),
+		)
+		opts = append(opts, m.dialOptions...)
+		return grpc.Dial(host, opts...)
 	}
 }
 
-func (managerClient *ManagerClientImpl) newPoolClient(host string) (*PoolClient, error) {
-	poolClient := &PoolClient{
-		host:     host,
-		username: managerClient.authentication.Username,
-		password: managerClient.authentication.Password,
-	}
-
-	// load client interceptor
-	managerClient.loadInterceptor()
-	// grpc pool with authentication interceptor
-	// p, err := grpcpool.New(poolClient.newFactoryClientWithInterceptor(managerClient.interceptor), managerClient.maxPoolSize, managerClient.maxPoolSize, time.Duration(managerClient.timeOut)*time.Second)
-	// if err != nil {
-	// 	return nil, err
-	// }
-
-	// grpc pool with credentials
-	p, err := grpcpool.New(poolClient.newFactoryClientWithCredentials(managerClient.interceptor), managerClient.maxPoolSize, managerClient.maxPoolSize, time.Duration(managerClient.timeOut)*time.Second)
-	if err != nil {
-		return nil, err
+// get or create pool of host
+func (m *managerClient) hostPool(host string) *connPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.pools[host]; ok {
+		return p
 	}
-
-	poolClient.pool = p
-
-	return poolClient, nil
+	p := newConnPool(host, m.poolSize, m.idleTimeout, m.factory(host), m.metrics)
+	m.pools[host] = p
+	return p
 }
 
-func (managerClient *ManagerClientImpl) addPoolClient(host string) (*PoolClient, error) {
-	poolClient, err := managerClient.newPoolClient(host)
+func (m *managerClient) GetClient(ctx context.Context, host string) (*PooledClient, error) {
+	p := m.hostPool(host)
+	conn, err := p.get(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	managerClient.poolClients.Set(host, poolClient)
+	// drop only the broken connection, redialed on next get
+	if state := conn.GetState(); state == connectivity.TransientFailure || state == connectivity.Shutdown {
+		p.discard(conn, evictBroken)
+		return nil, errors.New("bridge: pool connection failed: " + state.String())
+	}
 
-	return poolClient, nil
+	return &PooledClient{
+		Client: m.newClient(conn),
+		Host:   host,
+		conn:   conn,
+	}, nil
 }
 
-func (managerClient *ManagerClientImpl) getPoolClient(host string) *PoolClient {
-	pool, ok := managerClient.poolClients.Get(host)
-	if !ok {
-		return nil
+func (m *managerClient) Stats() map[string]PoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make(map[string]PoolStats, len(m.pools))
+	for host, p := range m.pools {
+		stats[host] = p.stats()
 	}
-
-	return pool.(*PoolClient)
+	return stats
 }
 
-func (managerClient *ManagerClientImpl) removePoolClient(host string) {
-	managerClient.poolClients.Remove(host)
+func (m *managerClient) Close() {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for host, p := range m.pools {
+		p.close()
+		delete(m.pools, host)
+	}
 }
 
-func (managerClient *ManagerClientImpl) GetClient(host string) (Client, error) {
-	pool := managerClient.getPoolClient(host)
-	if pool == nil {
-		poolImpl, err := managerClient.newPoolClient(host)
-		if err != nil {
-			log.Printf("[Manager Client] Get client with host '%v' error %+v\n", host, err)
-			return nil, err
-		}
-		pool = poolImpl
-
-		client, err := pool.newClient()
-		if err != nil {
-			managerClient.removePoolClient(host)
-			log.Printf("[Manager Client] Remove pool client with host '%v' error %+v\n", host, err)
-			return nil, err
-		}
-
-		// custom interceptor
-		// load interceptor with client implemetation service
-		// set client & gen jwt token
-		err = managerClient.interceptor.(*SimpleClientInterceptor).Load(client, managerClient.authMethods, managerClient.refreshDuration)
-		if err != nil {
-			return nil, err
-		}
-
-		// reload grpcpool on init for using jwt
-		pool, err = managerClient.addPoolClient(host)
-		if err != nil {
-			log.Printf("[Manager Client] Get client with host '%v' error %+v\n", host, err)
-			return nil, err
-		}
-		client, err = pool.newClient()
-		if err != nil {
-			managerClient.removePoolClient(host)
-			log.Printf("[Manager Client] Remove pool client with host '%v' error %+v\n", host, err)
-			return nil, err
+// prober health checks idle connections of every host each interval
+func (m *managerClient) prober() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.probe(now)
 		}
-		return client, nil
 	}
+}
 
-	client, err := pool.newClient()
-	if err != nil {
-		managerClient.removePoolClient(host)
-		log.Printf("[Manager Client] Remove pool client with host '%v' error %+v\n", host, err)
-		return nil, err
+// probe hosts concurrently, skip hosts in backoff
+func (m *managerClient) probe(now time.Time) {
+	m.mu.Lock()
+	pools := make([]*connPool, 0, len(m.pools))
+	for _, p := range m.pools {
+		pools = append(pools, p)
 	}
-	return client, nil
-}
+	m.mu.Unlock()
 
-func (managerClient *ManagerClientImpl) Close() {
-	for item := range managerClient.poolClients.IterBuffered() {
-		poolClient := item.Val.(*PoolClient)
-		poolClient.closePool()
+	var wg sync.WaitGroup
+	for _, p := range pools {
+		if now.Before(p.nextProbe) {
+			continue
+		}
+		wg.Add(1)
+		go func(p *connPool) {
+			defer wg.Done()
+			if p.probe(m.probeTimeout) {
+				if p.failures > 0 {
+					log.Printf("[Pool Manager] Host '%v' is reachable again\n", p.host)
+				}
+				p.failures, p.nextProbe = 0, time.Time{}
+				return
+			}
+			// exponential backoff while host is down
+			p.failures++
+			delay := m.probeInterval << uint(p.failures)
+			if delay <= 0 || delay > m.probeMaxBackoff {
+				delay = m.probeMaxBackoff
+			}
+			p.nextProbe = now.Add(delay)
+			log.Printf("[Pool Manager] Host '%v' is unhealthy (failures: %d), next probe in %v\n", p.host, p.failures, delay)
+		}(p)
 	}
+	wg.Wait()
 }
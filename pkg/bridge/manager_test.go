@@ -0,0 +1,278 @@
+package bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpc server w health service, requests w/o username are rejected
+func startServer(t *testing.T) (string, *health.Server) {
+	t.Helper()
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get("username")) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing username")
+		}
+		return handler(ctx, req)
+	}))
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(listen) }()
+	t.Cleanup(srv.Stop)
+	return listen.Addr().String(), hs
+}
+
+func TestManagerClient(t *testing.T) {
+	host, _ := startServer(t)
+	m, err := NewManagerClient(&configs.ManagerClient{
+		MaxPoolSize:    2,
+		TimeOut:        10,
+		Authentication: &configs.Authentication{Username: "user", Password: "pass"},
+	}, func(cc grpc.ClientConnInterface) interface{} {
+		return healthpb.NewHealthClient(cc)
+	})
+	if err != nil {
+		t.Fatalf("NewManagerClient() error = %v", err)
+	}
+	defer m.Close()
+
+	c, err := m.GetClient(context.Background(), host)
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	rsp, err := c.Client.(healthpb.HealthClient).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, want SERVING", rsp.GetStatus())
+	}
+
+	want := PoolStats{Capacity: 2, Available: 1, InUse: 1, Open: 1, Requests: 1}
+	if got := m.Stats()[host]; got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// released to pool
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	want = PoolStats{Capacity: 2, Available: 2, InUse: 0, Open: 1, Requests: 1}
+	if got := m.Stats()[host]; got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestManagerClient_Exhausted(t *testing.T) {
+	host, _ := startServer(t)
+	m, err := NewManagerClient(&configs.ManagerClient{MaxPoolSize: 1}, func(cc grpc.ClientConnInterface) interface{} {
+		return healthpb.NewHealthClient(cc)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	c, err := m.GetClient(context.Background(), host)
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	defer c.Close()
+
+	// no credentials configured
+	_, err = c.Client.(healthpb.HealthClient).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Check() code = %v, want %v", status.Code(err), codes.Unauthenticated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.GetClient(ctx, host); err == nil {
+		t.Error("GetClient() on exhausted pool error = nil")
+	}
+	if got := m.Stats()[host].Errors; got != 1 {
+		t.Errorf("Stats() errors = %d, want 1", got)
+	}
+}
+
+func TestManagerClient_Probe(t *testing.T) {
+	host, hs := startServer(t)
+	m, err := NewManagerClient(&configs.ManagerClient{
+		MaxPoolSize:    2,
+		Authentication: &configs.Authentication{Username: "user", Password: "pass"},
+		HealthCheck:    &configs.PoolHealthCheck{Interval: -1, Timeout: time.Second, MaxBackoff: time.Minute},
+	}, func(cc grpc.ClientConnInterface) interface{} {
+		return healthpb.NewHealthClient(cc)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	mc := m.(*managerClient)
+	mc.probeInterval = 10 * time.Second
+
+	// 2 idle connections
+	c1, err := m.GetClient(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := m.GetClient(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c1.Close()
+	_ = c2.Close()
+
+	// healthy connections are kept
+	now := time.Now()
+	mc.probe(now)
+	if got := m.Stats()[host]; got.Open != 2 || got.Evictions != 0 {
+		t.Errorf("Stats() = %+v, want 2 open & no evictions", got)
+	}
+
+	// host down: connections evicted, a failed replacement, backoff
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	mc.probe(now)
+	if got := m.Stats()[host]; got.Open != 0 || got.Evictions != 3 {
+		t.Errorf("Stats() = %+v, want 0 open & 3 evictions", got)
+	}
+	p := mc.hostPool(host)
+	if want := now.Add(20 * time.Second); !p.nextProbe.Equal(want) {
+		t.Errorf("nextProbe = %v, want %v", p.nextProbe, want)
+	}
+
+	// skipped during backoff
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	mc.probe(now.Add(10 * time.Second))
+	if p.failures != 1 {
+		t.Errorf("failures = %d, want 1", p.failures)
+	}
+	mc.probe(now.Add(20 * time.Second))
+	if p.failures != 0 || !p.nextProbe.IsZero() {
+		t.Errorf("failures = %d, nextProbe = %v, want reset", p.failures, p.nextProbe)
+	}
+
+	// checkout still works after evictions
+	c, err := m.GetClient(context.Background(), host)
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	if _, err := c.Client.(healthpb.HealthClient).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	_ = c.Close()
+}
+
+func TestConnPool_IdleTimeout(t *testing.T) {
+	host, _ := startServer(t)
+	dials := 0
+	p := newConnPool(host, 1, time.Minute, func() (*grpc.ClientConn, error) {
+		dials++
+		return grpc.Dial(host, grpc.WithInsecure())
+	}, newPoolMetrics())
+	defer p.close()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	conn, err := p.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = p.put(conn)
+	if conn, err = p.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = p.put(conn)
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+
+	// idle connection expired, redialed
+	now = now.Add(2 * time.Minute)
+	if conn, err = p.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = p.put(conn)
+	if got := p.stats(); dials != 2 || got.Open != 1 || got.Evictions != 1 {
+		t.Errorf("dials = %d, stats = %+v, want 2 dials, 1 open & 1 eviction", dials, got)
+	}
+}
+
+// blockingHealth holds health checks until released
+type blockingHealth struct {
+	healthpb.UnimplementedHealthServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h.entered <- struct{}{}
+	<-h.release
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func TestConnPool_ProbeCapacity(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := &blockingHealth{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(listen) }()
+	defer srv.Stop()
+
+	host := listen.Addr().String()
+	dials := 0
+	p := newConnPool(host, 1, 0, func() (*grpc.ClientConn, error) {
+		dials++
+		return grpc.Dial(host, grpc.WithInsecure())
+	}, newPoolMetrics())
+	defer p.close()
+
+	conn, err := p.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = p.put(conn)
+
+	probed := make(chan bool)
+	go func() { probed <- p.probe(5 * time.Second) }()
+	<-hs.entered
+
+	// probed connection is checked out: wait instead of dialing over capacity
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("get() during probe error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(hs.release)
+	if !<-probed {
+		t.Error("probe() = false, want reachable")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if conn, err = p.get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = p.put(conn)
+	if got := p.stats(); dials != 1 || got.Open != 1 {
+		t.Errorf("dials = %d, stats = %+v, want 1 dial & 1 open", dials, got)
+	}
+}
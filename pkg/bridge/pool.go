@@ -0,0 +1,311 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// eviction reasons
+const (
+	evictUnhealthy   = "unhealthy"
+	evictIdleTimeout = "idle_timeout"
+	evictBroken      = "broken"
+)
+
+var errPoolClosed = errors.New("bridge: pool is closed")
+
+// pool metrics per host
+type poolMetrics struct {
+	connections *prometheus.GaugeVec
+	inUse       *prometheus.GaugeVec
+	wait        *prometheus.HistogramVec
+	evictions   *prometheus.CounterVec
+}
+
+func newPoolMetrics() *poolMetrics {
+	return &poolMetrics{
+		connections: metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bridge_pool_connections",
+			Help: "Number of open pooled connections per host.",
+		}, []string{"host"})).(*prometheus.GaugeVec),
+		inUse: metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bridge_pool_in_use",
+			Help: "Number of pooled connections checked out per host.",
+		}, []string{"host"})).(*prometheus.GaugeVec),
+		wait: metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "bridge_pool_wait_seconds",
+			Help:    "Histogram of time waiting for a pooled connection.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"host"})).(*prometheus.HistogramVec),
+		evictions: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "bridge_pool_evictions_total",
+			Help: "Total number of pooled connections evicted per host & reason.",
+		}, []string{"host", "reason"})).(*prometheus.CounterVec),
+	}
+}
+
+type pooledConn struct {
+	*grpc.ClientConn
+	pool     *connPool
+	lastUsed time.Time
+}
+
+// connPool holds up to size connections to a host
+type connPool struct {
+	host        string
+	dial        func() (*grpc.ClientConn, error)
+	idleTimeout time.Duration
+	metrics     *poolMetrics
+	now         func() time.Time
+
+	// capacity: a token per checked out connection
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*pooledConn
+	open   int
+	closed bool
+
+	requests  uint64
+	errors    uint64
+	evictions uint64
+
+	// prober backoff while host is down
+	failures  int
+	nextProbe time.Time
+}
+
+func newConnPool(host string, size int, idleTimeout time.Duration, dial func() (*grpc.ClientConn, error), m *poolMetrics) *connPool {
+	return &connPool{
+		host:        host,
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		metrics:     m,
+		now:         time.Now,
+		slots:       make(chan struct{}, size),
+	}
+}
+
+// get waits for a free slot, reuse an idle connection or dial a new one
+func (p *connPool) get(ctx context.Context) (*pooledConn, error) {
+	atomic.AddUint64(&p.requests, 1)
+
+	start := p.now()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		atomic.AddUint64(&p.errors, 1)
+		return nil, ctx.Err()
+	}
+	p.metrics.wait.WithLabelValues(p.host).Observe(p.now().Sub(start).Seconds())
+
+	conn, err := p.take()
+	if err != nil {
+		<-p.slots
+		atomic.AddUint64(&p.errors, 1)
+		return nil, err
+	}
+	p.metrics.inUse.WithLabelValues(p.host).Set(float64(len(p.slots)))
+	return conn, nil
+}
+
+func (p *connPool) take() (*pooledConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.idleTimeout > 0 && p.now().Sub(conn.lastUsed) > p.idleTimeout {
+			p.evictLocked(conn, evictIdleTimeout)
+			continue
+		}
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+	return p.newConn()
+}
+
+func (p *connPool) newConn() (*pooledConn, error) {
+	cc, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.open++
+	p.metrics.connections.WithLabelValues(p.host).Set(float64(p.open))
+	p.mu.Unlock()
+	return &pooledConn{ClientConn: cc, pool: p, lastUsed: p.now()}, nil
+}
+
+// put returns connection to idle list & frees its slot
+func (p *connPool) put(conn *pooledConn) error {
+	p.mu.Lock()
+	if p.closed {
+		p.evictLocked(conn, "")
+	} else {
+		conn.lastUsed = p.now()
+		p.idle = append(p.idle, conn)
+	}
+	p.mu.Unlock()
+	<-p.slots
+	p.metrics.inUse.WithLabelValues(p.host).Set(float64(len(p.slots)))
+	return nil
+}
+
+// discard closes a broken checked out connection & frees its slot
+func (p *connPool) discard(conn *pooledConn, reason string) {
+	atomic.AddUint64(&p.errors, 1)
+	p.mu.Lock()
+	p.evictLocked(conn, reason)
+	p.mu.Unlock()
+	<-p.slots
+	p.metrics.inUse.WithLabelValues(p.host).Set(float64(len(p.slots)))
+}
+
+// close connection w/o slot, empty reason: not counted as eviction (pool closed)
+func (p *connPool) evictLocked(conn *pooledConn, reason string) {
+	_ = conn.ClientConn.Close()
+	p.open--
+	p.metrics.connections.WithLabelValues(p.host).Set(float64(p.open))
+	if reason != "" {
+		atomic.AddUint64(&p.evictions, 1)
+		p.metrics.evictions.WithLabelValues(p.host, reason).Inc()
+	}
+}
+
+// probe health checks idle connections, evicts & replaces bad ones
+// return whether host is reachable
+func (p *connPool) probe(timeout time.Duration) bool {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return true
+	}
+	// probed connections are checked out: hold a slot each, get() can't dial over capacity meanwhile
+	var conns []*pooledConn
+	for len(p.idle) > 0 && p.reserveSlot() {
+		conns = append(conns, p.idle[len(p.idle)-1])
+		p.idle = p.idle[:len(p.idle)-1]
+	}
+	p.mu.Unlock()
+	defer p.releaseSlots(len(conns))
+
+	var healthy []*pooledConn
+	evicted := 0
+	for _, conn := range conns {
+		if checkConn(conn.ClientConn, timeout) {
+			healthy = append(healthy, conn)
+			continue
+		}
+		p.mu.Lock()
+		p.evictLocked(conn, evictUnhealthy)
+		p.mu.Unlock()
+		evicted++
+	}
+
+	// replace evicted connections while the host answers
+	reachable := evicted == 0
+	for i := 0; i < evicted; i++ {
+		conn, err := p.newConn()
+		if err != nil {
+			break
+		}
+		if !checkConn(conn.ClientConn, timeout) {
+			p.mu.Lock()
+			p.evictLocked(conn, evictUnhealthy)
+			p.mu.Unlock()
+			break
+		}
+		reachable = true
+		healthy = append(healthy, conn)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		for _, conn := range healthy {
+			p.evictLocked(conn, "")
+		}
+		return reachable
+	}
+	p.idle = append(p.idle, healthy...)
+	return reachable
+}
+
+// reserveSlot takes a slot w/o waiting
+func (p *connPool) reserveSlot() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *connPool) releaseSlots(n int) {
+	for i := 0; i < n; i++ {
+		<-p.slots
+	}
+	p.metrics.inUse.WithLabelValues(p.host).Set(float64(len(p.slots)))
+}
+
+// checkConn checks connection state & grpc health service (if implemented)
+func checkConn(cc *grpc.ClientConn, timeout time.Duration) bool {
+	if state := cc.GetState(); state == connectivity.Shutdown {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	rsp, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	switch status.Code(err) {
+	case codes.OK:
+		return rsp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+	case codes.Unimplemented:
+		// reachable w/o health service
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	open := p.open
+	p.mu.Unlock()
+	inUse := len(p.slots)
+	return PoolStats{
+		Capacity:  cap(p.slots),
+		Available: cap(p.slots) - inUse,
+		InUse:     inUse,
+		Open:      open,
+		Requests:  atomic.LoadUint64(&p.requests),
+		Errors:    atomic.LoadUint64(&p.errors),
+		Evictions: atomic.LoadUint64(&p.evictions),
+	}
+}
+
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, conn := range p.idle {
+		p.evictLocked(conn, "")
+	}
+	p.idle = nil
+}
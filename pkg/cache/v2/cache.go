@@ -0,0 +1,378 @@
+// Package cache is the context-aware cache: per-key ttl, pluggable codecs
+// & single-flight loaders w negative caching
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+)
+
+// store types
+const (
+	TypeRedis  = "redis"
+	TypeMemory = "memory"
+	TypeTiered = "tiered"
+)
+
+// tiered: default ttl of the memory tier
+const defaultLocalTTL = 1 * time.Minute
+
+// entry flags, first byte of stored values
+const (
+	flagValue    byte = 0
+	flagNotFound byte = 1
+)
+
+var (
+	DefaultCache         Cache
+	ErrCacheNotAvailable = errors.New("cache: not available")
+	// ErrNotFound is returned by loaders when the value does not exist,
+	// cached for negative ttl then returned by Get & GetOrLoad
+	ErrNotFound = errors.New("cache: not found")
+)
+
+// Loader loads value on cache miss
+type Loader func(ctx context.Context) (interface{}, error)
+
+// Tagger is implemented by loaded values adding their own tags, eg. ids known after the load
+type Tagger interface {
+	CacheTags() []string
+}
+
+type Cache interface {
+	// Get decodes cached value into v, ErrCacheMiss when missing
+	Get(ctx context.Context, key string, v interface{}) error
+	// Set caches v for ttl, 0 uses default ttl, tags group keys for InvalidateTag
+	Set(ctx context.Context, key string, v interface{}, ttl time.Duration, tags ...string) error
+	Delete(ctx context.Context, keys ...string) error
+	// GetOrLoad decodes cached value into v or calls loader once for concurrent callers of same key,
+	// loaded value is tagged w tags & its CacheTags if it is a Tagger
+	GetOrLoad(ctx context.Context, key string, ttl time.Duration, v interface{}, loader Loader, tags ...string) error
+	// InvalidateTag deletes every key tagged w tags
+	InvalidateTag(ctx context.Context, tags ...string) error
+	// Ratio returns hits / (hits + misses)
+	Ratio() float64
+	Close() error
+}
+
+type cache struct {
+	opts  Options
+	store Store
+	group singleflight.Group
+
+	hits   uint64
+	misses uint64
+}
+
+var _ Cache = (*cache)(nil)
+
+func NewCache(store Store, opts ...Option) (Cache, error) {
+	return newCache(store, opts...)
+}
+
+func newCache(store Store, opts ...Option) (*cache, error) {
+	c := &cache{
+		opts: Options{
+			ttl:         defaultTTL,
+			negativeTTL: defaultNegativeTTL,
+			loadTimeout: defaultLoadTimeout,
+			codec:       JSONCodec{},
+			logger:      log.DefaultLogger,
+		},
+		store: store,
+	}
+	for _, o := range opts {
+		if err := o(&c.opts); err != nil {
+			return nil, err
+		}
+	}
+	c.opts.logger = c.opts.logger.With(zap.String("cache", c.opts.prefix))
+	return c, nil
+}
+
+// New creates cache of config type w redis store (redis & tiered), tiered falls back to memory w/o store
+// tiered w redis subscribes to invalidations of other instances
+func New(config *configs.Cache, store *redis.Redis, opts ...Option) (Cache, error) {
+	storeType := TypeRedis
+	localTTL := defaultLocalTTL
+	size := defaultSize
+	channel := DefaultInvalidationChannel
+	if config != nil {
+		if config.Type != "" {
+			storeType = config.Type
+		}
+		if config.LocalExpiration > 0 {
+			localTTL = config.LocalExpiration
+		}
+		if config.Size > 0 {
+			size = config.Size
+		}
+		if config.InvalidationChannel != "" {
+			channel = config.InvalidationChannel
+		}
+		codec, err := NewCodec(config.Codec)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]Option{WithTTL(config.Expiration), WithNegativeTTL(config.NegativeExpiration), WithCodec(codec)}, opts...)
+	}
+	switch storeType {
+	case TypeRedis:
+		if store == nil {
+			return nil, ErrCacheNotAvailable
+		}
+		return NewCache(NewRedisStore(store), opts...)
+	case TypeMemory:
+		return NewCache(NewMemoryStore(size), opts...)
+	case TypeTiered:
+		if store == nil {
+			return NewCache(NewMemoryStore(size), opts...)
+		}
+		local := newMemoryStore(size)
+		invalidator := NewInvalidator(store.GetClient(), channel, local, log.DefaultLogger.With(zap.String("cache", "invalidator")))
+		return NewCache(NewTieredStore(local, NewRedisStore(store), localTTL, invalidator), opts...)
+	default:
+		return nil, fmt.Errorf("unknown cache type: %q", storeType)
+	}
+}
+
+func (c *cache) getKey(key string) string {
+	return c.opts.prefix + key
+}
+
+// tag sets share the key prefix
+func (c *cache) getTagKeys(tags []string) []string {
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag != "" {
+			tagKeys = append(tagKeys, c.opts.prefix+"tag:"+tag)
+		}
+	}
+	return tagKeys
+}
+
+func (c *cache) getTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return c.opts.ttl
+	}
+	return ttl
+}
+
+func (c *cache) Get(ctx context.Context, key string, v interface{}) error {
+	data, err := c.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.opts.codec.Unmarshal(data, v)
+}
+
+// get returns encoded value, ErrNotFound on negative entry
+func (c *cache) get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := c.store.Get(ctx, c.getKey(key))
+	if err == ErrCacheMiss {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&c.hits, 1)
+	if len(entry) == 0 || entry[0] == flagNotFound {
+		return nil, ErrNotFound
+	}
+	return entry[1:], nil
+}
+
+func (c *cache) Set(ctx context.Context, key string, v interface{}, ttl time.Duration, tags ...string) error {
+	data, err := c.opts.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.set(ctx, key, data, ttl, tags)
+}
+
+// set tags key before storing value, so invalidation never misses a stored key
+func (c *cache) set(ctx context.Context, key string, data []byte, ttl time.Duration, tags []string) error {
+	ttl = c.getTTL(ttl)
+	if err := c.tag(ctx, key, ttl, tags); err != nil {
+		return err
+	}
+	entry := make([]byte, 0, len(data)+1)
+	entry = append(append(entry, flagValue), data...)
+	return c.store.Set(ctx, c.getKey(key), entry, ttl)
+}
+
+func (c *cache) tag(ctx context.Context, key string, ttl time.Duration, tags []string) error {
+	tagKeys := c.getTagKeys(tags)
+	if len(tagKeys) == 0 {
+		return nil
+	}
+	ts, ok := c.store.(TagStore)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+	return ts.AddTags(ctx, c.getKey(key), ttl, tagKeys...)
+}
+
+func (c *cache) setNotFound(ctx context.Context, key string) error {
+	if c.opts.negativeTTL < 0 {
+		return nil
+	}
+	return c.store.Set(ctx, c.getKey(key), []byte{flagNotFound}, c.opts.negativeTTL)
+}
+
+func (c *cache) Delete(ctx context.Context, keys ...string) error {
+	storeKeys := make([]string, len(keys))
+	for i, key := range keys {
+		storeKeys[i] = c.getKey(key)
+	}
+	return c.store.Delete(ctx, storeKeys...)
+}
+
+func (c *cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, v interface{}, loader Loader, tags ...string) error {
+	data, err := c.get(ctx, key)
+	if err == nil {
+		return c.opts.codec.Unmarshal(data, v)
+	} else if err == ErrNotFound {
+		return err
+	} else if err != ErrCacheMiss {
+		// store down: still serve from loader
+		c.opts.logger.For(ctx).Error("Get cache", zap.String("key", key), zap.Error(err))
+	}
+	// shared by every caller: the first one's cancellation must not fail the others
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, c.opts.loadTimeout)
+		defer cancel()
+		value, err := loader(ctx)
+		if errors.Is(err, ErrNotFound) {
+			if e := c.setNotFound(ctx, key); e != nil {
+				c.opts.logger.For(ctx).Error("Set not found cache", zap.String("key", key), zap.Error(e))
+			}
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		data, err := c.opts.codec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		tags := tags
+		if t, ok := value.(Tagger); ok {
+			tags = append(tags[:len(tags):len(tags)], t.CacheTags()...)
+		}
+		if e := c.set(ctx, key, data, ttl, tags); e != nil {
+			c.opts.logger.For(ctx).Error("Set cache", zap.String("key", key), zap.Error(e))
+		}
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return res.Err
+		}
+		return c.opts.codec.Unmarshal(res.Val.([]byte), v)
+	}
+}
+
+// detachedContext keeps values (trace, logger fields) of the caller w/o its deadline & cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c *cache) InvalidateTag(ctx context.Context, tags ...string) error {
+	tagKeys := c.getTagKeys(tags)
+	if len(tagKeys) == 0 {
+		return nil
+	}
+	ts, ok := c.store.(TagStore)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+	_, err := ts.InvalidateTags(ctx, tagKeys...)
+	return err
+}
+
+func (c *cache) Ratio() float64 {
+	hits, misses := atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+func (c *cache) Close() error {
+	return c.store.Close()
+}
+
+func Get(ctx context.Context, key string, v interface{}) error {
+	if DefaultCache == nil {
+		return ErrCacheNotAvailable
+	}
+	return DefaultCache.Get(ctx, key, v)
+}
+
+func Set(ctx context.Context, key string, v interface{}, ttl time.Duration, tags ...string) error {
+	if DefaultCache == nil {
+		return ErrCacheNotAvailable
+	}
+	return DefaultCache.Set(ctx, key, v, ttl, tags...)
+}
+
+func Delete(ctx context.Context, keys ...string) error {
+	if DefaultCache == nil {
+		return ErrCacheNotAvailable
+	}
+	return DefaultCache.Delete(ctx, keys...)
+}
+
+// GetOrLoad calls loader directly w/o default cache
+func GetOrLoad(ctx context.Context, key string, ttl time.Duration, v interface{}, loader Loader, tags ...string) error {
+	if DefaultCache == nil {
+		value, err := loader(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := JSONCodec{}.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return JSONCodec{}.Unmarshal(data, v)
+	}
+	return DefaultCache.GetOrLoad(ctx, key, ttl, v, loader, tags...)
+}
+
+func InvalidateTag(ctx context.Context, tags ...string) error {
+	if DefaultCache == nil {
+		return ErrCacheNotAvailable
+	}
+	return DefaultCache.InvalidateTag(ctx, tags...)
+}
+
+func Close() error {
+	if DefaultCache == nil {
+		return ErrCacheNotAvailable
+	}
+	return DefaultCache.Close()
+}
+
+func Ratio() float64 {
+	if DefaultCache == nil {
+		return 0.0
+	}
+	return DefaultCache.Ratio()
+}
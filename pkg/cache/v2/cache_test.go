@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+type user struct {
+	ID   string `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+// user tagged by its loaded name
+type namedUser struct {
+	user
+}
+
+func (u *namedUser) CacheTags() []string {
+	return []string{"name:" + u.Name}
+}
+
+func TestCache(t *testing.T) {
+	store := newMemoryStore(10)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	c, err := newCache(store, WithPrefix("test_"), WithTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var got user
+	if err := c.Get(ctx, "a", &got); err != ErrCacheMiss {
+		t.Errorf("Get() error = %v, want %v", err, ErrCacheMiss)
+	}
+	_ = c.Set(ctx, "a", &user{ID: "a"}, 0)
+	_ = c.Set(ctx, "b", &user{ID: "b"}, time.Hour)
+	if err := c.Get(ctx, "a", &got); err != nil || got.ID != "a" {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+	if _, ok := store.items["test_a"]; !ok {
+		t.Error("key w/o prefix")
+	}
+
+	// per-key ttl
+	now = now.Add(time.Minute)
+	if err := c.Get(ctx, "a", &got); err != ErrCacheMiss {
+		t.Errorf("Get() expired error = %v, want %v", err, ErrCacheMiss)
+	}
+	if err := c.Get(ctx, "b", &got); err != nil || got.ID != "b" {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+	_ = c.Delete(ctx, "b")
+	if err := c.Get(ctx, "b", &got); err != ErrCacheMiss {
+		t.Errorf("Get() deleted error = %v, want %v", err, ErrCacheMiss)
+	}
+	if got, want := c.Ratio(), 0.4; got != want {
+		t.Errorf("Ratio() = %v, want %v", got, want)
+	}
+}
+
+func TestCache_GetOrLoad(t *testing.T) {
+	c, err := newCache(newMemoryStore(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// concurrent callers share one load
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &user{ID: "a", Name: "alice"}, nil
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got user
+			if err := c.GetOrLoad(ctx, "a", 0, &got, loader); err != nil {
+				errs <- err
+			} else if got.Name != "alice" {
+				errs <- errors.New("got " + got.Name)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("GetOrLoad() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("loader calls = %d, want 1", calls)
+	}
+
+	// cached
+	var got user
+	if err := c.GetOrLoad(ctx, "a", 0, &got, loader); err != nil || got.ID != "a" || calls != 1 {
+		t.Errorf("GetOrLoad() cached = %+v, %v, calls %d", got, err, calls)
+	}
+
+	// loader errors are not cached
+	errLoad := errors.New("db down")
+	failed := func(ctx context.Context) (interface{}, error) { return nil, errLoad }
+	if err := c.GetOrLoad(ctx, "b", 0, &got, failed); err != errLoad {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, errLoad)
+	}
+	if err := c.Get(ctx, "b", &got); err != ErrCacheMiss {
+		t.Errorf("Get() error = %v, want %v", err, ErrCacheMiss)
+	}
+
+	// not found cached
+	calls = 0
+	notFound := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.GetOrLoad(ctx, "c", 0, &got, notFound); err != ErrNotFound {
+			t.Errorf("GetOrLoad() error = %v, want %v", err, ErrNotFound)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader calls = %d, want 1", calls)
+	}
+}
+
+func TestCache_GetOrLoadCancel(t *testing.T) {
+	c, err := newCache(newMemoryStore(10), WithLoadTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type ctxKey struct{}
+	first, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "first"))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		if ctx.Value(ctxKey{}) != "first" {
+			return nil, errors.New("values of the caller lost")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("no load timeout")
+		}
+		return &user{ID: "a"}, ctx.Err()
+	}
+
+	firstErr := make(chan error, 1)
+	go func() {
+		var got user
+		firstErr <- c.GetOrLoad(first, "a", 0, &got, loader)
+	}()
+	<-started
+	waiterErr := make(chan error, 1)
+	var got user
+	go func() {
+		waiterErr <- c.GetOrLoad(context.Background(), "a", 0, &got, loader)
+	}()
+
+	// first caller gives up, the shared load goes on
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("GetOrLoad() cancelled error = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-waiterErr; err != nil || got.ID != "a" {
+		t.Errorf("GetOrLoad() waiter = %+v, %v", got, err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	for _, name := range []string{CodecJSON, CodecMsgpack} {
+		codec, err := NewCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := codec.Marshal(&user{ID: "a", Name: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got user
+		if err := codec.Unmarshal(data, &got); err != nil || got.Name != "alice" {
+			t.Errorf("%s Unmarshal() = %+v, %v", name, got, err)
+		}
+	}
+	if _, err := (ProtoCodec{}).Marshal(&user{}); err != ErrNotProtoMessage {
+		t.Errorf("proto Marshal() error = %v, want %v", err, ErrNotProtoMessage)
+	}
+	if _, err := NewCodec("xml"); err == nil {
+		t.Error("NewCodec() unknown error = nil")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, nil); err != ErrCacheNotAvailable {
+		t.Errorf("New() redis w/o store error = %v, want %v", err, ErrCacheNotAvailable)
+	}
+	c, err := New(&configs.Cache{Type: TypeTiered, Codec: CodecMsgpack}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(*cache).store.(*memoryStore); !ok {
+		t.Errorf("New() tiered w/o store = %T, want memory store", c.(*cache).store)
+	}
+	if _, err := New(&configs.Cache{Codec: "xml"}, nil); err == nil {
+		t.Error("New() unknown codec error = nil")
+	}
+}
+
+func TestCache_InvalidateTag(t *testing.T) {
+	store := newMemoryStore(10)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	c, err := newCache(store, WithPrefix("test_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_ = c.Set(ctx, "user", &user{ID: "u"}, time.Hour, "user:u")
+	_ = c.Set(ctx, "account", &user{ID: "a"}, time.Minute, "user:u", "account:a")
+	_ = c.Set(ctx, "other", &user{ID: "o"}, time.Hour, "user:o")
+	if _, ok := store.tags["test_tag:user:u"]; !ok {
+		t.Error("tag w/o prefix")
+	}
+
+	if err := c.InvalidateTag(ctx, "account:a"); err != nil {
+		t.Fatal(err)
+	}
+	var got user
+	if err := c.Get(ctx, "account", &got); err != ErrCacheMiss {
+		t.Errorf("Get() invalidated error = %v, want %v", err, ErrCacheMiss)
+	}
+	if err := c.Get(ctx, "user", &got); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if err := c.InvalidateTag(ctx, "user:u"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, "user", &got); err != ErrCacheMiss {
+		t.Errorf("Get() invalidated error = %v, want %v", err, ErrCacheMiss)
+	}
+	if err := c.Get(ctx, "other", &got); err != nil {
+		t.Errorf("Get() other tag error = %v", err)
+	}
+
+	// tag set expires w its longest-lived key
+	_ = c.Set(ctx, "a", &user{ID: "a"}, time.Minute, "t")
+	_ = c.Set(ctx, "b", &user{ID: "b"}, time.Hour, "t")
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.tags["test_tag:t"]; !ok {
+		t.Fatal("tag expired before its keys")
+	}
+	now = now.Add(time.Hour)
+	_ = c.Set(ctx, "c", &user{ID: "c"}, time.Hour, "t")
+	if tag := store.tags["test_tag:t"]; len(tag.keys) != 1 {
+		t.Errorf("expired tag keys = %v, want [test_c]", tag.keys)
+	}
+
+	// loaded values are tagged
+	loader := func(ctx context.Context) (interface{}, error) { return &user{ID: "d"}, nil }
+	_ = c.GetOrLoad(ctx, "d", 0, &got, loader, "user:d")
+	_ = c.InvalidateTag(ctx, "user:d")
+	if err := c.Get(ctx, "d", &got); err != ErrCacheMiss {
+		t.Errorf("Get() loaded & invalidated error = %v, want %v", err, ErrCacheMiss)
+	}
+
+	// w tags of the loaded value
+	loader = func(ctx context.Context) (interface{}, error) { return &namedUser{user{ID: "e", Name: "n"}}, nil }
+	_ = c.GetOrLoad(ctx, "e", 0, &got, loader, "user:e")
+	_ = c.InvalidateTag(ctx, "name:n")
+	if err := c.Get(ctx, "e", &got); err != ErrCacheMiss {
+		t.Errorf("Get() loaded & invalidated by value tag error = %v, want %v", err, ErrCacheMiss)
+	}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+)
+
+// DefaultInvalidationChannel is the redis channel of invalidation messages
+const DefaultInvalidationChannel = "cache-invalidation"
+
+// subscriber: ping interval while idle & max delay between reconnects
+const (
+	invalidationPingInterval = 30 * time.Second
+	invalidationMaxBackoff   = 30 * time.Second
+)
+
+// LocalTier is the in-process tier evicted by invalidation messages of other instances
+type LocalTier interface {
+	Evict(keys ...string)
+	// Flush drops every key, messages are missed while subscriber is disconnected
+	Flush()
+}
+
+// invalidation message, keys are full store keys (w prefix)
+type invalidation struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+	// unix nano at publish, for lag
+	Time int64 `json:"time"`
+}
+
+type invalidationMetrics struct {
+	messages   *prometheus.CounterVec
+	lag        *prometheus.HistogramVec
+	reconnects *prometheus.CounterVec
+}
+
+func newInvalidationMetrics() *invalidationMetrics {
+	return &invalidationMetrics{
+		messages: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_invalidation_messages_total",
+			Help: "Total number of cache invalidation messages per channel & direction.",
+		}, []string{"channel", "direction"})).(*prometheus.CounterVec),
+		lag: metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cache_invalidation_lag_seconds",
+			Help:    "Histogram of time from publishing an invalidation to evicting the local tier.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"channel"})).(*prometheus.HistogramVec),
+		reconnects: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_invalidation_reconnects_total",
+			Help: "Total number of invalidation subscriber reconnects per channel.",
+		}, []string{"channel"})).(*prometheus.CounterVec),
+	}
+}
+
+// Invalidator publishes set & deleted keys on a redis channel
+// & evicts keys published by other instances from the local tier
+type Invalidator struct {
+	client  goredis.UniversalClient
+	channel string
+	source  string
+	local   LocalTier
+	logger  log.Factory
+	metrics *invalidationMetrics
+	now     func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewInvalidator starts subscriber in background until Close
+func NewInvalidator(client goredis.UniversalClient, channel string, local LocalTier, logger log.Factory) *Invalidator {
+	i := newInvalidator(client, channel, local, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		i.run(ctx)
+	}()
+	return i
+}
+
+func newInvalidator(client goredis.UniversalClient, channel string, local LocalTier, logger log.Factory) *Invalidator {
+	if channel == "" {
+		channel = DefaultInvalidationChannel
+	}
+	if logger == nil {
+		logger = log.DefaultLogger
+	}
+	return &Invalidator{
+		client:  client,
+		channel: channel,
+		source:  uuid.New().String(),
+		local:   local,
+		logger:  logger.With(zap.String("channel", channel)),
+		metrics: newInvalidationMetrics(),
+		now:     time.Now,
+	}
+}
+
+// Publish broadcasts keys to other instances, failures are logged & left to local ttl
+func (i *Invalidator) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	msg, err := json.Marshal(&invalidation{Source: i.source, Keys: keys, Time: i.now().UnixNano()})
+	if err != nil {
+		return err
+	}
+	if err := i.client.Publish(ctx, i.channel, msg).Err(); err != nil {
+		i.logger.For(ctx).Error("Publish invalidation", zap.Strings("keys", keys), zap.Error(err))
+		return err
+	}
+	i.metrics.messages.WithLabelValues(i.channel, "published").Inc()
+	return nil
+}
+
+func (i *Invalidator) Close() error {
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.wg.Wait()
+	return nil
+}
+
+// run subscribes until ctx done, reconnects w exponential backoff
+func (i *Invalidator) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		connected, err := i.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// keys set while disconnected are unknown
+		i.local.Flush()
+		i.metrics.reconnects.WithLabelValues(i.channel).Inc()
+		i.logger.Bg().Error("Invalidation subscriber disconnected", zap.Error(err))
+		if connected {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > invalidationMaxBackoff {
+			backoff = invalidationMaxBackoff
+		}
+	}
+}
+
+// subscribe receives messages until error, connected once subscription confirmed
+func (i *Invalidator) subscribe(ctx context.Context) (bool, error) {
+	ps := i.client.Subscribe(ctx, i.channel)
+	defer func() {
+		if err := ps.Close(); err != nil {
+			i.logger.Bg().Error("Close subscriber", zap.Error(err))
+		}
+	}()
+	// subscription confirmation
+	if _, err := ps.Receive(ctx); err != nil {
+		return false, err
+	}
+	for {
+		msg, err := ps.ReceiveTimeout(ctx, invalidationPingInterval)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			if err := ps.Ping(ctx); err != nil {
+				return true, err
+			}
+			continue
+		} else if err != nil {
+			return true, err
+		}
+		switch m := msg.(type) {
+		case *goredis.Message:
+			i.handle(m.Payload)
+		case *goredis.Subscription:
+			// resubscribed by client after reconnect
+			i.local.Flush()
+		}
+	}
+}
+
+// handle evicts keys of other instances, own writes already updated the local tier
+func (i *Invalidator) handle(payload string) {
+	var msg invalidation
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		i.logger.Bg().Error("Decode invalidation", zap.Error(err))
+		return
+	}
+	if msg.Source == i.source {
+		return
+	}
+	i.local.Evict(msg.Keys...)
+	i.metrics.messages.WithLabelValues(i.channel, "received").Inc()
+	if msg.Time > 0 {
+		i.metrics.lag.WithLabelValues(i.channel).Observe(i.now().Sub(time.Unix(0, msg.Time)).Seconds())
+	}
+}
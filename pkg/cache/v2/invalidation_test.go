@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+type fakeTier struct {
+	mu      sync.Mutex
+	evicted []string
+	flushes int
+}
+
+func (f *fakeTier) Evict(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.evicted = append(f.evicted, keys...)
+}
+
+func (f *fakeTier) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes++
+}
+
+func (f *fakeTier) state() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.evicted...), f.flushes
+}
+
+func TestInvalidator_Handle(t *testing.T) {
+	tier := &fakeTier{}
+	i := newInvalidator(nil, "", tier, nil)
+	if i.channel != DefaultInvalidationChannel {
+		t.Errorf("channel = %s, want %s", i.channel, DefaultInvalidationChannel)
+	}
+	payload := func(source string, keys ...string) string {
+		msg, _ := json.Marshal(&invalidation{Source: source, Keys: keys, Time: time.Now().UnixNano()})
+		return string(msg)
+	}
+
+	i.handle(payload("other", "a", "b"))
+	// own writes skipped
+	i.handle(payload(i.source, "c"))
+	i.handle("{")
+	if evicted, _ := tier.state(); len(evicted) != 2 || evicted[0] != "a" || evicted[1] != "b" {
+		t.Errorf("evicted = %v, want [a b]", evicted)
+	}
+}
+
+func TestInvalidator_Reconnect(t *testing.T) {
+	// nothing listening: subscriber keeps reconnecting & flushing local tier
+	client := goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer func() { _ = client.Close() }()
+	tier := &fakeTier{}
+	i := NewInvalidator(client, "test", tier, nil)
+
+	if err := i.Publish(context.Background(), "a"); err == nil {
+		t.Error("Publish() error = nil")
+	}
+	deadline := time.Now().Add(time.Second)
+	for _, flushes := tier.state(); flushes == 0 && time.Now().Before(deadline); _, flushes = tier.state() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, flushes := tier.state(); flushes == 0 {
+		t.Error("local tier not flushed after disconnect")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = i.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close() blocked")
+	}
+}
+
+func TestTieredStore_Evict(t *testing.T) {
+	ctx := context.Background()
+	local, remote := newMemoryStore(10), newMemoryStore(10)
+	s := NewTieredStore(local, remote, time.Minute, nil)
+	_ = s.Set(ctx, "a", []byte("a"), time.Hour)
+	_ = s.Set(ctx, "b", []byte("b"), time.Hour)
+
+	// evicted by other instance: reloaded from remote
+	local.Evict("a")
+	if _, err := local.Get(ctx, "a"); err != ErrCacheMiss {
+		t.Errorf("local Get() error = %v, want %v", err, ErrCacheMiss)
+	}
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "a" {
+		t.Errorf("Get() = %s, %v", v, err)
+	}
+	local.Flush()
+	if _, err := local.Get(ctx, "b"); err != ErrCacheMiss {
+		t.Errorf("local Get() flushed error = %v, want %v", err, ErrCacheMiss)
+	}
+}
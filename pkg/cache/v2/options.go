@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+)
+
+// defaultTTL defaults time for a value in the cache to expire
+const defaultTTL = 1 * time.Hour
+
+// defaultNegativeTTL defaults time for a not found marker to expire
+const defaultNegativeTTL = 30 * time.Second
+
+// defaultLoadTimeout bounds shared loads of GetOrLoad, detached from callers' cancellation
+const defaultLoadTimeout = 10 * time.Second
+
+// defaultSize defines maximum number of items in memory store
+const defaultSize = 200
+
+type Option func(*Options) error
+
+func WithPrefix(prefix string) Option {
+	return func(c *Options) error {
+		c.prefix = prefix
+		return nil
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Options) error {
+		if ttl > 0 {
+			c.ttl = ttl
+		}
+		return nil
+	}
+}
+
+// WithNegativeTTL sets ttl of not found markers, negative disables negative caching
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Options) error {
+		if ttl != 0 {
+			c.negativeTTL = ttl
+		}
+		return nil
+	}
+}
+
+// WithLoadTimeout sets the deadline of shared loads, callers still return on their own ctx
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(c *Options) error {
+		if timeout > 0 {
+			c.loadTimeout = timeout
+		}
+		return nil
+	}
+}
+
+func WithCodec(codec Codec) Option {
+	return func(c *Options) error {
+		if codec != nil {
+			c.codec = codec
+		}
+		return nil
+	}
+}
+
+func WithLogger(logger log.Factory) Option {
+	return func(c *Options) error {
+		if logger != nil {
+			c.logger = logger
+		}
+		return nil
+	}
+}
+
+type Options struct {
+	prefix      string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loadTimeout time.Duration
+	codec       Codec
+	logger      log.Factory
+}
@@ -0,0 +1,462 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrCacheMiss        = errors.New("cache: key is missing")
+	ErrTagsNotSupported = errors.New("cache: store does not support tags")
+)
+
+// Store keeps encoded values w ttl
+type Store interface {
+	// Get returns ErrCacheMiss when key is missing or expired
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// TagStore keeps sets of keys per tag
+type TagStore interface {
+	// AddTags adds key to tags, tag sets live at least ttl
+	AddTags(ctx context.Context, key string, ttl time.Duration, tags ...string) error
+	// InvalidateTags deletes keys of tags & the tag sets, returns deleted keys
+	InvalidateTags(ctx context.Context, tags ...string) ([]string, error)
+}
+
+// in-process store: least recently used keys are evicted over size
+type memoryStore struct {
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	tags  map[string]*memoryTag
+	// tags per key, drops evicted keys from tag sets
+	keyTags map[string]map[string]struct{}
+}
+
+type memoryItem struct {
+	key    string
+	value  []byte
+	expiry time.Time
+}
+
+type memoryTag struct {
+	keys   map[string]struct{}
+	expiry time.Time
+}
+
+var (
+	_ Store     = (*memoryStore)(nil)
+	_ TagStore  = (*memoryStore)(nil)
+	_ LocalTier = (*memoryStore)(nil)
+)
+
+func NewMemoryStore(size int) Store {
+	return newMemoryStore(size)
+}
+
+func newMemoryStore(size int) *memoryStore {
+	if size <= 0 {
+		size = defaultSize
+	}
+	return &memoryStore{
+		size:    size,
+		now:     time.Now,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+		tags:    make(map[string]*memoryTag),
+		keyTags: make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	item := e.Value.(*memoryItem)
+	if !s.now().Before(item.expiry) {
+		s.removeLocked(e)
+		return nil, ErrCacheMiss
+	}
+	s.lru.MoveToFront(e)
+	return item.value, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	expiry := s.now().Add(ttl)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		item := e.Value.(*memoryItem)
+		item.value, item.expiry = value, expiry
+		s.lru.MoveToFront(e)
+		return nil
+	}
+	s.items[key] = s.lru.PushFront(&memoryItem{key: key, value: value, expiry: expiry})
+	for s.lru.Len() > s.size {
+		s.removeLocked(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, keys ...string) error {
+	s.Evict(keys...)
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	s.Flush()
+	return nil
+}
+
+// Evict implements LocalTier
+func (s *memoryStore) Evict(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if e, ok := s.items[key]; ok {
+			s.removeLocked(e)
+		}
+	}
+}
+
+// Flush implements LocalTier
+func (s *memoryStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(map[string]*list.Element)
+	s.lru.Init()
+	s.tags = make(map[string]*memoryTag)
+	s.keyTags = make(map[string]map[string]struct{})
+}
+
+func (s *memoryStore) AddTags(_ context.Context, key string, ttl time.Duration, tags ...string) error {
+	expiry := s.now().Add(ttl)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		t, ok := s.tags[tag]
+		if !ok || !s.now().Before(t.expiry) {
+			if ok {
+				// expired set: keys no longer belong to the tag
+				for k := range t.keys {
+					s.untagLocked(k, tag)
+				}
+			}
+			t = &memoryTag{keys: make(map[string]struct{})}
+			s.tags[tag] = t
+		}
+		t.keys[key] = struct{}{}
+		if expiry.After(t.expiry) {
+			t.expiry = expiry
+		}
+		if _, ok := s.keyTags[key]; !ok {
+			s.keyTags[key] = make(map[string]struct{})
+		}
+		s.keyTags[key][tag] = struct{}{}
+	}
+	return nil
+}
+
+func (s *memoryStore) InvalidateTags(_ context.Context, tags ...string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for _, tag := range tags {
+		t, ok := s.tags[tag]
+		if !ok {
+			continue
+		}
+		delete(s.tags, tag)
+		expired := !s.now().Before(t.expiry)
+		for key := range t.keys {
+			if expired {
+				s.untagLocked(key, tag)
+				continue
+			}
+			if e, ok := s.items[key]; ok {
+				s.removeLocked(e)
+			} else {
+				s.untagLocked(key)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// removeLocked deletes the item & its key from tag sets
+func (s *memoryStore) removeLocked(e *list.Element) {
+	key := e.Value.(*memoryItem).key
+	s.lru.Remove(e)
+	delete(s.items, key)
+	s.untagLocked(key)
+}
+
+// untagLocked deletes key from the given or all of its tag sets, empty sets are dropped
+func (s *memoryStore) untagLocked(key string, tags ...string) {
+	if len(tags) == 0 {
+		for tag := range s.keyTags[key] {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range tags {
+		if t, ok := s.tags[tag]; ok {
+			delete(t.keys, key)
+			if len(t.keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+		delete(s.keyTags[key], tag)
+	}
+	if len(s.keyTags[key]) == 0 {
+		delete(s.keyTags, key)
+	}
+}
+
+// tag sets: add key & extend ttl, never shorten
+var addTagsScript = goredis.NewScript(`
+for _, tag in ipairs(KEYS) do
+	redis.call('SADD', tag, ARGV[1])
+	if redis.call('PTTL', tag) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', tag, ARGV[2])
+	end
+end
+return 0`)
+
+// delete keys of tag sets & the sets, returns deleted keys
+var invalidateTagsScript = goredis.NewScript(`
+local keys = {}
+for _, tag in ipairs(KEYS) do
+	for _, key in ipairs(redis.call('SMEMBERS', tag)) do
+		redis.call('DEL', key)
+		table.insert(keys, key)
+	end
+	redis.call('DEL', tag)
+end
+return keys`)
+
+// redis store, connection is owned by the caller
+// in cluster, multi-key commands run per key: keys & tag sets live in different slots
+type redisStore struct {
+	client  goredis.UniversalClient
+	cluster bool
+}
+
+var (
+	_ Store    = (*redisStore)(nil)
+	_ TagStore = (*redisStore)(nil)
+)
+
+func NewRedisStore(store *redis.Redis) Store {
+	return &redisStore{client: store.GetClient(), cluster: store.IsCluster()}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if err == goredis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if !s.cluster {
+		return s.client.Del(ctx, keys...).Err()
+	}
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) AddTags(ctx context.Context, key string, ttl time.Duration, tags ...string) error {
+	if !s.cluster {
+		if len(tags) == 0 {
+			return nil
+		}
+		return addTagsScript.Run(ctx, s.client, tags, key, ttl.Milliseconds()).Err()
+	}
+	for _, tag := range tags {
+		if err := addTagsScript.Run(ctx, s.client, []string{tag}, key, ttl.Milliseconds()).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redisStore) InvalidateTags(ctx context.Context, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	if s.cluster {
+		return s.invalidateTagsCluster(ctx, tags...)
+	}
+	res, err := invalidateTagsScript.Run(ctx, s.client, tags).Result()
+	if err != nil {
+		return nil, err
+	}
+	values, _ := res.([]interface{})
+	keys := make([]string, 0, len(values))
+	for _, key := range values {
+		if key, ok := key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// script can't delete keys outside the slot of tag set
+func (s *redisStore) invalidateTagsCluster(ctx context.Context, tags ...string) ([]string, error) {
+	var keys []string
+	for _, tag := range tags {
+		members, err := s.client.SMembers(ctx, tag).Result()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Delete(ctx, members...); err != nil {
+			return nil, err
+		}
+		if err := s.client.Del(ctx, tag).Err(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, members...)
+	}
+	return keys, nil
+}
+
+func (s *redisStore) Close() error {
+	return nil
+}
+
+// two-tier store: local in front of remote, local ttl capped by localTTL
+// w invalidator, writes evict the key from local tiers of other instances
+type tieredStore struct {
+	local       Store
+	remote      Store
+	localTTL    time.Duration
+	invalidator *Invalidator
+}
+
+var (
+	_ Store    = (*tieredStore)(nil)
+	_ TagStore = (*tieredStore)(nil)
+)
+
+// NewTieredStore creates two-tier store, invalidator is optional
+func NewTieredStore(local, remote Store, localTTL time.Duration, invalidator *Invalidator) Store {
+	return &tieredStore{local: local, remote: remote, localTTL: localTTL, invalidator: invalidator}
+}
+
+func (s *tieredStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, err := s.local.Get(ctx, key); err == nil {
+		return value, nil
+	}
+	value, err := s.remote.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.local.Set(ctx, key, value, s.localTTL); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *tieredStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.remote.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	localTTL := ttl
+	if localTTL > s.localTTL {
+		localTTL = s.localTTL
+	}
+	if err := s.local.Set(ctx, key, value, localTTL); err != nil {
+		return err
+	}
+	s.invalidate(ctx, key)
+	return nil
+}
+
+func (s *tieredStore) Delete(ctx context.Context, keys ...string) error {
+	if err := s.local.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	if err := s.remote.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	s.invalidate(ctx, keys...)
+	return nil
+}
+
+// tags are kept by remote
+func (s *tieredStore) AddTags(ctx context.Context, key string, ttl time.Duration, tags ...string) error {
+	ts, ok := s.remote.(TagStore)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+	return ts.AddTags(ctx, key, ttl, tags...)
+}
+
+func (s *tieredStore) InvalidateTags(ctx context.Context, tags ...string) ([]string, error) {
+	ts, ok := s.remote.(TagStore)
+	if !ok {
+		return nil, ErrTagsNotSupported
+	}
+	keys, err := ts.InvalidateTags(ctx, tags...)
+	if err != nil || len(keys) == 0 {
+		return keys, err
+	}
+	if err := s.local.Delete(ctx, keys...); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, keys...)
+	return keys, nil
+}
+
+// invalidate publishes keys, failures don't fail writes: stale only until local ttl
+func (s *tieredStore) invalidate(ctx context.Context, keys ...string) {
+	if s.invalidator == nil {
+		return
+	}
+	// logged by invalidator
+	_ = s.invalidator.Publish(ctx, keys...)
+}
+
+func (s *tieredStore) Close() error {
+	if s.invalidator != nil {
+		if err := s.invalidator.Close(); err != nil {
+			return err
+		}
+	}
+	err := s.local.Close()
+	if remoteErr := s.remote.Close(); err == nil {
+		err = remoteErr
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_LRU(t *testing.T) {
+	s := newMemoryStore(2)
+	ctx := context.Background()
+	_ = s.Set(ctx, "a", []byte("a"), time.Minute)
+	_ = s.Set(ctx, "b", []byte("b"), time.Minute)
+	_, _ = s.Get(ctx, "a")
+	_ = s.Set(ctx, "c", []byte("c"), time.Minute)
+
+	// least recently used evicted
+	if _, err := s.Get(ctx, "b"); err != ErrCacheMiss {
+		t.Errorf("Get() evicted error = %v, want %v", err, ErrCacheMiss)
+	}
+	for _, key := range []string{"a", "c"} {
+		if v, err := s.Get(ctx, key); err != nil || string(v) != key {
+			t.Errorf("Get(%s) = %s, %v", key, v, err)
+		}
+	}
+}
+
+func TestMemoryStore_Tags(t *testing.T) {
+	s := newMemoryStore(2)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		_ = s.AddTags(ctx, key, time.Minute, "all", "tag:"+key)
+		_ = s.Set(ctx, key, []byte(key), time.Minute)
+	}
+	// "a" evicted over size
+	if _, ok := s.tags["tag:a"]; ok || len(s.tags["all"].keys) != 2 {
+		t.Errorf("tags after eviction = %v, want w/o a", s.tags)
+	}
+	_ = s.Delete(ctx, "b")
+	if _, ok := s.tags["tag:b"]; ok || len(s.tags["all"].keys) != 1 {
+		t.Errorf("tags after delete = %v, want w/o b", s.tags)
+	}
+
+	// tagged but not stored yet
+	_ = s.AddTags(ctx, "d", time.Minute, "tag:d")
+	keys, _ := s.InvalidateTags(ctx, "all", "tag:d")
+	if len(keys) != 2 {
+		t.Errorf("InvalidateTags() = %v, want [c d]", keys)
+	}
+	if len(s.tags) != 0 || len(s.keyTags) != 0 {
+		t.Errorf("tags = %v, key tags = %v, want empty", s.tags, s.keyTags)
+	}
+}
+
+func TestMemoryStore_Concurrent(t *testing.T) {
+	s := newMemoryStore(50)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprint(j % 60)
+				_ = s.Set(ctx, key, []byte(fmt.Sprint(i)), time.Minute)
+				_, _ = s.Get(ctx, key)
+				_ = s.Delete(ctx, fmt.Sprint((j+i)%60))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(s.items); n > 50 {
+		t.Errorf("items = %d, want <= 50", n)
+	}
+}
+
+func TestTieredStore(t *testing.T) {
+	local, remote := newMemoryStore(10), newMemoryStore(10)
+	s := NewTieredStore(local, remote, time.Minute, nil)
+	ctx := context.Background()
+
+	// filled from remote
+	_ = remote.Set(ctx, "a", []byte("a"), time.Hour)
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "a" {
+		t.Errorf("Get() = %s, %v", v, err)
+	}
+	if _, err := local.Get(ctx, "a"); err != nil {
+		t.Errorf("local Get() error = %v", err)
+	}
+
+	// writes & deletes go to both
+	_ = s.Set(ctx, "b", []byte("b"), time.Hour)
+	if v, err := remote.Get(ctx, "b"); err != nil || string(v) != "b" {
+		t.Errorf("remote Get() = %s, %v", v, err)
+	}
+	if e := local.items["b"]; e == nil || e.Value.(*memoryItem).expiry.After(local.now().Add(time.Minute)) {
+		t.Error("local ttl over localTTL")
+	}
+	_ = s.Delete(ctx, "b")
+	if _, err := s.Get(ctx, "b"); err != ErrCacheMiss {
+		t.Errorf("Get() deleted error = %v, want %v", err, ErrCacheMiss)
+	}
+}
@@ -0,0 +1,237 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+	"github.com/1412335/grpc-rest-microservice/pkg/utils"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var certExpiry = metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "tls_certificate_expiry_timestamp_seconds",
+	Help: "Expiry (unix timestamp) of the TLS certificate currently served.",
+}, []string{"cert"})).(*prometheus.GaugeVec)
+
+type Option func(*Manager) error
+
+func WithLoggerFactory(logger log.Factory) Option {
+	return func(m *Manager) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+// Manager serves the latest key pair (& client CA) loaded from PEM files
+// reload when files change or on SIGHUP
+type Manager struct {
+	config *configs.TLSCert
+	logger log.Factory
+
+	mu         sync.RWMutex
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	clientAuth tls.ClientAuthType
+
+	watcher   *fsnotify.Watcher
+	signals   chan os.Signal
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewManager(config *configs.TLSCert, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		config: config,
+		logger: log.DefaultLogger,
+		done:   make(chan struct{}),
+	}
+	for _, o := range opts {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	m.logger = m.logger.With(zap.String("component", "cert-manager"))
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload reads PEM files, the current key pair is kept on failure
+// an invalid client auth mode fails instead of turning mTLS off
+func (m *Manager) Reload() error {
+	clientAuth, err := utils.ParseClientAuth(m.config.ClientAuth)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(m.config.CertPem, m.config.KeyPem)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+
+	var clientCAs *x509.CertPool
+	if clientAuth != tls.NoClientCert {
+		pemClientCA, err := ioutil.ReadFile(m.config.CACert)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pemClientCA) {
+			return fmt.Errorf("failed to add client CA's certificate")
+		}
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.clientCAs = clientCAs
+	m.clientAuth = clientAuth
+	m.mu.Unlock()
+
+	certExpiry.WithLabelValues(m.config.CertPem).Set(float64(cert.Leaf.NotAfter.Unix()))
+	m.logger.Bg().Info("Loaded TLS certificate",
+		zap.String("cert", m.config.CertPem),
+		zap.String("subject", cert.Leaf.Subject.CommonName),
+		zap.Time("notAfter", cert.Leaf.NotAfter),
+	)
+	return nil
+}
+
+// Watch reloads certificates on files changes & SIGHUP until Close
+func (m *Manager) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch directories: files may be replaced (eg. kubernetes secrets symlinks)
+	dirs := map[string]bool{}
+	for _, path := range []string{m.config.CertPem, m.config.KeyPem, m.config.CACert} {
+		if path == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+	m.watcher = watcher
+	m.signals = make(chan os.Signal, 1)
+	signal.Notify(m.signals, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-m.done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+					continue
+				}
+				m.reload("file changed")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				m.logger.Bg().Error("Watch certificates failed", zap.Error(err))
+			case <-m.signals:
+				m.reload("SIGHUP")
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) reload(reason string) {
+	if err := m.Reload(); err != nil {
+		m.logger.Bg().Error("Reload TLS certificate failed", zap.String("reason", reason), zap.Error(err))
+	}
+}
+
+// Close stops watching
+func (m *Manager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		if m.signals != nil {
+			signal.Stop(m.signals)
+		}
+		if m.watcher != nil {
+			err = m.watcher.Close()
+		}
+	})
+	return err
+}
+
+// Certificate returns the current key pair
+func (m *Manager) Certificate() *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert
+}
+
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// GetClientCertificate presents the current key pair as client certificate (mTLS)
+func (m *Manager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// ServerTLSConfig serves the latest key pair & client CA for every handshake
+// NOTE: per handshake config advertises h2 & http/1.1 (grpc, gateway)
+func (m *Manager) ServerTLSConfig() *tls.Config {
+	m.mu.RLock()
+	clientAuth := m.clientAuth
+	m.mu.RUnlock()
+	return m.serverTLSConfig(clientAuth)
+}
+
+// ServerTLSConfigNoClientAuth serves the latest key pair w/o client certificates (eg. public REST gateway)
+func (m *Manager) ServerTLSConfigNoClientAuth() *tls.Config {
+	return m.serverTLSConfig(tls.NoClientCert)
+}
+
+func (m *Manager) serverTLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	base := &tls.Config{
+		ClientAuth:     clientAuth,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: m.GetCertificate,
+	}
+	config := base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*m.cert}
+		c.ClientCAs = m.clientCAs
+		return c, nil
+	}
+	return config
+}
@@ -0,0 +1,89 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeKeyPair writes a self-signed key pair expiring at notAfter
+func writeKeyPair(t *testing.T, certPem, keyPem string, serial int64, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: "v3"}, NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	// key first: the watcher reloads on cert change
+	if err := ioutil.WriteFile(keyPem, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir := t.TempDir()
+	config := &configs.TLSCert{CertPem: filepath.Join(dir, "server-cert.pem"), KeyPem: filepath.Join(dir, "server-key.pem")}
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	writeKeyPair(t, config.CertPem, config.KeyPem, 1, expiry)
+
+	m, err := NewManager(config)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer m.Close()
+	if err := m.Watch(); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if got := testutil.ToFloat64(certExpiry.WithLabelValues(config.CertPem)); got != float64(expiry.Unix()) {
+		t.Errorf("expiry metric = %v, want %v", got, expiry.Unix())
+	}
+
+	// rotate
+	writeKeyPair(t, config.CertPem, config.KeyPem, 2, expiry.Add(time.Hour))
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Certificate().Leaf.SerialNumber.Int64() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate not reloaded after files changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// handshakes use the latest key pair
+	tlsConfig, err := m.ServerTLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatalf("GetConfigForClient() error = %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if leaf.SerialNumber.Int64() != 2 {
+		t.Errorf("GetConfigForClient() serial = %v, want 2", leaf.SerialNumber)
+	}
+}
+
+func TestManagerInvalidClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	config := &configs.TLSCert{CertPem: filepath.Join(dir, "server-cert.pem"), KeyPem: filepath.Join(dir, "server-key.pem"), ClientAuth: "requried"}
+	writeKeyPair(t, config.CertPem, config.KeyPem, 1, time.Now().Add(time.Hour))
+	if _, err := NewManager(config); err == nil {
+		t.Error("NewManager() invalid client auth error = nil, want mTLS not silently off")
+	}
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/registry"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	// client side health checking
+	_ "google.golang.org/grpc/health"
+)
+
+// load balancing policies
+const (
+	PickFirst    = "pick_first"
+	RoundRobin   = "round_robin"
+	LeastRequest = "least_request"
+)
+
+// resolver scheme of static endpoints
+const staticScheme = "static"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(LeastRequest, &leastRequestPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// least_request: power of two random choices between ready backends w fewer in-flight requests
+type leastRequestPickerBuilder struct{}
+
+func (*leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &leastRequestPicker{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for sc := range info.ReadySCs {
+		p.subConns = append(p.subConns, &subConnRequests{subConn: sc})
+	}
+	return p
+}
+
+type subConnRequests struct {
+	subConn  balancer.SubConn
+	inFlight int64
+}
+
+type leastRequestPicker struct {
+	subConns []*subConnRequests
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	picked := p.subConns[0]
+	if len(p.subConns) > 1 {
+		p.mu.Lock()
+		a, b := p.rand.Intn(len(p.subConns)), p.rand.Intn(len(p.subConns)-1)
+		p.mu.Unlock()
+		// distinct second choice
+		if b >= a {
+			b++
+		}
+		picked = p.subConns[a]
+		if atomic.LoadInt64(&p.subConns[b].inFlight) < atomic.LoadInt64(&picked.inFlight) {
+			picked = p.subConns[b]
+		}
+	}
+	atomic.AddInt64(&picked.inFlight, 1)
+	return balancer.PickResult{
+		SubConn: picked.subConn,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(&picked.inFlight, -1)
+		},
+	}, nil
+}
+
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	HealthCheckConfig   *healthCheckConfig    `json:"healthCheckConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// default service config json: load balancing policy & health checking
+func buildServiceConfig(cfgs *configs.ClientConfig) (string, error) {
+	sc := serviceConfig{}
+	if cfgs.LoadBalancingPolicy != "" {
+		sc.LoadBalancingConfig = []map[string]struct{}{{cfgs.LoadBalancingPolicy: {}}}
+	}
+	if cfgs.HealthCheck != nil {
+		sc.HealthCheckConfig = &healthCheckConfig{ServiceName: cfgs.HealthCheck.ServiceName}
+	}
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// resolve dial target & options: resolver target, static endpoints, registry or GRPC.Host:Port
+func (c *Client) target(addr string) (string, []grpc.DialOption) {
+	var opts []grpc.DialOption
+	if c.registry != nil {
+		opts = append(opts, grpc.WithResolvers(registry.NewResolverBuilder(c.registry)))
+	}
+	switch {
+	case c.config.Target != "":
+		return c.config.Target, opts
+	case len(c.config.Endpoints) > 0:
+		r := manual.NewBuilderWithScheme(staticScheme)
+		addrs := make([]resolver.Address, 0, len(c.config.Endpoints))
+		for _, endpoint := range c.config.Endpoints {
+			addrs = append(addrs, resolver.Address{Addr: endpoint})
+		}
+		r.InitialState(resolver.State{Addresses: addrs})
+		return staticScheme + ":///" + c.config.ServiceName, append(opts, grpc.WithResolvers(r))
+	case c.registry != nil:
+		return registry.Scheme + ":///" + c.config.ServiceName, opts
+	default:
+		return addr, nil
+	}
+}
+
+// log connectivity state changes until the connection is closed
+func (c *Client) watchState() {
+	state := c.ClientConn.GetState()
+	for {
+		if !c.ClientConn.WaitForStateChange(context.Background(), state) {
+			return
+		}
+		newState := c.ClientConn.GetState()
+		if newState == connectivity.TransientFailure {
+			c.logger.Error("Connection state changed", zap.Stringer("from", state), zap.Stringer("to", newState))
+		} else {
+			c.logger.Info("Connection state changed", zap.Stringer("from", state), zap.Stringer("to", newState))
+		}
+		if newState == connectivity.Shutdown {
+			return
+		}
+		state = newState
+	}
+}
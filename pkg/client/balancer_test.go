@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/registry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+// start grpc servers serving health service, return their addresses
+func startBackends(t *testing.T, statuses ...healthpb.HealthCheckResponse_ServingStatus) []string {
+	t.Helper()
+	var addrs []string
+	for _, st := range statuses {
+		listen, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := grpc.NewServer()
+		hs := health.NewServer()
+		hs.SetServingStatus("", st)
+		healthpb.RegisterHealthServer(srv, hs)
+		go func() { _ = srv.Serve(listen) }()
+		t.Cleanup(srv.Stop)
+		addrs = append(addrs, listen.Addr().String())
+	}
+	return addrs
+}
+
+func TestNew_LoadBalancing(t *testing.T) {
+	for _, policy := range []string{RoundRobin, LeastRequest} {
+		t.Run(policy, func(t *testing.T) {
+			addrs := startBackends(t,
+				healthpb.HealthCheckResponse_SERVING,
+				healthpb.HealthCheckResponse_SERVING,
+				healthpb.HealthCheckResponse_NOT_SERVING,
+			)
+			c, err := New(&configs.ClientConfig{
+				ServiceName:         "test",
+				Endpoints:           addrs,
+				LoadBalancingPolicy: policy,
+				HealthCheck:         &configs.ClientHealthCheck{},
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer c.Close()
+
+			client := healthpb.NewHealthClient(c.ClientConn)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// wait for both healthy backends
+			backends := make(map[string]int)
+			for i := 0; i < 100 && len(backends) < 2; i++ {
+				var p peer.Peer
+				if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&p)); err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				backends[p.Addr.String()]++
+			}
+			for i := 0; i < 20; i++ {
+				var p peer.Peer
+				if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p)); err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				backends[p.Addr.String()]++
+			}
+
+			if len(backends) != 2 {
+				t.Errorf("backends = %v, want 2 healthy backends", backends)
+			}
+			if _, ok := backends[addrs[2]]; ok {
+				t.Errorf("unhealthy backend %s picked", addrs[2])
+			}
+		})
+	}
+}
+
+type testSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func TestLeastRequestPicker(t *testing.T) {
+	busy, idle := &subConnRequests{subConn: &testSubConn{name: "busy"}, inFlight: 10}, &subConnRequests{subConn: &testSubConn{name: "idle"}}
+	picker := (&leastRequestPickerBuilder{}).Build(base.PickerBuildInfo{})
+	if _, err := picker.Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick() w/o ready backends error = %v, want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+
+	lr := &leastRequestPicker{subConns: []*subConnRequests{busy, idle}, rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 10; i++ {
+		rsp, err := lr.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		if rsp.SubConn.(*testSubConn).name != "idle" {
+			t.Errorf("Pick() = %s, want idle", rsp.SubConn.(*testSubConn).name)
+		}
+		rsp.Done(balancer.DoneInfo{})
+	}
+	if idle.inFlight != 0 {
+		t.Errorf("inFlight = %d after done, want 0", idle.inFlight)
+	}
+}
+
+func TestBuildServiceConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfgs *configs.ClientConfig
+		want string
+	}{
+		{name: "default", cfgs: &configs.ClientConfig{}, want: `{}`},
+		{
+			name: "round robin w health check",
+			cfgs: &configs.ClientConfig{LoadBalancingPolicy: RoundRobin, HealthCheck: &configs.ClientHealthCheck{ServiceName: "api_v3.UserService"}},
+			want: `{"loadBalancingConfig":[{"round_robin":{}}],"healthCheckConfig":{"serviceName":"api_v3.UserService"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildServiceConfig(tt.cfgs)
+			if err != nil {
+				t.Fatalf("buildServiceConfig() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("buildServiceConfig() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Registry(t *testing.T) {
+	addrs := startBackends(t, healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_SERVING)
+	r := registry.NewMemoryRegistry()
+	instances := make([]*registry.Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		instance := &registry.Instance{ID: addr, Name: "test", Address: addr}
+		if err := r.Register(context.Background(), instance); err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, instance)
+	}
+
+	c, err := New(&configs.ClientConfig{ServiceName: "test", LoadBalancingPolicy: RoundRobin}, WithRegistry(r))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+	if got, want := c.ClientConn.Target(), "registry:///test"; got != want {
+		t.Errorf("Target() = %s, want %s", got, want)
+	}
+
+	client := healthpb.NewHealthClient(c.ClientConn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pick := func() string {
+		var p peer.Peer
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&p)); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		return p.Addr.String()
+	}
+
+	backends := make(map[string]int)
+	for i := 0; i < 100 && len(backends) < 2; i++ {
+		backends[pick()]++
+	}
+	if len(backends) != 2 {
+		t.Errorf("backends = %v, want 2 registered backends", backends)
+	}
+
+	// deregistered backend is dropped
+	if err := r.Deregister(context.Background(), instances[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && pick() == addrs[0]; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		if got := pick(); got != addrs[1] {
+			t.Fatalf("picked %s after deregister, want %s", got, addrs[1])
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	interceptor "github.com/1412335/grpc-rest-microservice/pkg/interceptor/client"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/registry"
 	"github.com/1412335/grpc-rest-microservice/pkg/tracing"
 	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 
@@ -32,11 +33,20 @@ func WithInterceptors(interceptor ...interceptor.ClientInterceptor) Option {
 	}
 }
 
+// WithRegistry resolves registry:///<service> targets, override config Registry
+func WithRegistry(r registry.Registry) Option {
+	return func(c *Client) error {
+		c.registry = r
+		return nil
+	}
+}
+
 type Client struct {
 	config       *configs.ClientConfig
 	ClientConn   *grpc.ClientConn
 	logger       log.Factory
 	interceptors []interceptor.ClientInterceptor
+	registry     registry.Registry
 }
 
 func New(cfgs *configs.ClientConfig, opt ...Option) (*Client, error) {
@@ -54,8 +64,22 @@ func New(cfgs *configs.ClientConfig, opt ...Option) (*Client, error) {
 		return nil, err
 	}
 
+	// service discovery
+	if client.registry == nil && cfgs.Registry != nil {
+		r, err := registry.New(cfgs.Registry, registry.WithLoggerFactory(client.logger))
+		if err != nil {
+			client.logger.Error("Create service registry error", zap.Error(err))
+			return nil, err
+		}
+		client.registry = r
+	}
+
 	// resolve grpc-server address
-	addr := net.JoinHostPort(cfgs.GRPC.Host, strconv.Itoa(cfgs.GRPC.Port))
+	var addr string
+	if cfgs.GRPC != nil {
+		addr = net.JoinHostPort(cfgs.GRPC.Host, strconv.Itoa(cfgs.GRPC.Port))
+	}
+	target, resolverOpts := client.target(addr)
 
 	// gRPC client options
 	opts := []grpc.DialOption{
@@ -80,26 +104,37 @@ func New(cfgs *configs.ClientConfig, opt ...Option) (*Client, error) {
 	opts = append(opts, client.buildInterceptors()...)
 
 	callOptions := []grpc.CallOption{}
-	if cfgs.GRPC.MaxCallRecvMsgSize > 0 {
+	if cfgs.GRPC != nil && cfgs.GRPC.MaxCallRecvMsgSize > 0 {
 		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(cfgs.GRPC.MaxCallRecvMsgSize))
 	}
-	if cfgs.GRPC.MaxCallSendMsgSize > 0 {
+	if cfgs.GRPC != nil && cfgs.GRPC.MaxCallSendMsgSize > 0 {
 		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(cfgs.GRPC.MaxCallSendMsgSize))
 	}
 	if len(callOptions) > 0 {
 		opts = append(opts, grpc.WithDefaultCallOptions(callOptions...))
 	}
 
+	// load balancing & health checking
+	serviceConfig, err := buildServiceConfig(cfgs)
+	if err != nil {
+		client.logger.Error("Build service config failed", zap.Error(err))
+		return nil, err
+	}
+	opts = append(opts, grpc.WithDefaultServiceConfig(serviceConfig))
+	opts = append(opts, resolverOpts...)
+
 	// connect grpc server
 	conn, err := grpc.Dial(
-		addr,
+		target,
 		opts...,
 	)
 	if err != nil {
-		client.logger.Error("Dial grpc server failed", zap.Error(err))
+		client.logger.Error("Dial grpc server failed", zap.String("target", target), zap.Error(err))
 		return nil, err
 	}
 	client.ClientConn = conn
+	client.logger.Info("Dial grpc server", zap.String("target", target), zap.String("lb-policy", cfgs.LoadBalancingPolicy))
+	go client.watchState()
 	return client, nil
 }
 
@@ -114,7 +149,8 @@ func (c *Client) Init(opt ...Option) error {
 }
 
 func (c *Client) loadClientTLSCredentials() (credentials.TransportCredentials, error) {
-	config, err := utils.LoadClientTLSConfig(c.config.TLSCert.CACert)
+	// present client certificate if configured (mTLS)
+	config, err := utils.LoadClientTLSConfigWithCert(c.config.TLSCert.CACert, c.config.TLSCert.CertPem, c.config.TLSCert.KeyPem)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +176,20 @@ func (c *Client) buildInterceptors() []grpc.DialOption {
 	var unaryInterceptors []grpc.UnaryClientInterceptor
 	var streamInterceptors []grpc.StreamClientInterceptor
 
+	// fail fast while downstream is failing, w/o retrying
+	if c.config.CircuitBreaker != nil {
+		breaker := interceptor.NewCircuitBreakerClientInterceptor(c.config.CircuitBreaker)
+		unaryInterceptors = append(unaryInterceptors, breaker.Unary())
+		streamInterceptors = append(streamInterceptors, breaker.Stream())
+	}
+
+	// deadline, retries & hedging: each attempt traced as a separate call
+	if len(c.config.Methods) > 0 {
+		retryInterceptor := interceptor.NewRetryClientInterceptor(c.config.Methods)
+		unaryInterceptors = append(unaryInterceptors, retryInterceptor.Unary())
+		streamInterceptors = append(streamInterceptors, retryInterceptor.Stream())
+	}
+
 	// tracing
 	if c.config.EnableTracing {
 		unaryTracing, streamTracing := c.tracingInterceptor()
@@ -147,6 +197,13 @@ func (c *Client) buildInterceptors() []grpc.DialOption {
 		streamInterceptors = append(streamInterceptors, streamTracing)
 	}
 
+	// prometheus metrics
+	if c.config.EnableMetrics {
+		metricsInterceptor := interceptor.NewMetricsClientInterceptor()
+		unaryInterceptors = append(unaryInterceptors, metricsInterceptor.Unary())
+		streamInterceptors = append(streamInterceptors, metricsInterceptor.Stream())
+	}
+
 	// client interceptors
 	interceptor.DefaultLogger = c.logger.With(zap.String("interceptor-type", "client"))
 	for _, i := range c.interceptors {
@@ -24,6 +24,8 @@ type ServiceConfig struct {
 	Authentication *Authentication
 	// redis
 	Redis *Redis
+	// model caching
+	Cache *Cache
 	// server using
 	AccessibleRoles     map[string][]string
 	AuthRequiredMethods map[string]bool
@@ -32,13 +34,28 @@ type ServiceConfig struct {
 	// opentracing
 	EnableTracing bool
 	Tracing       *Tracing
+	// prometheus metrics
+	EnableMetrics bool
+	// admin http server (metrics)
+	Admin *Admin
 	// insecure
 	EnableTLS bool
 	TLSCert   *TLSCert
+	// serve grpc + gateway on GRPC.Port (Proxy.Port unused)
+	EnableMultiplex bool
 	// swaggers
 	Swagger []string
 	// log factory
 	Log *Log
+	// grpc health checking
+	HealthCheck *HealthCheck
+	// rate limiting per full method name
+	RateLimits []*RateLimit
+	// request validation w generated Validate(), except skipped full method names
+	EnableValidation      bool
+	SkipValidationMethods []string
+	// register on start & deregister on shutdown
+	Registry *Registry
 }
 
 type ClientConfig struct {
@@ -49,9 +66,91 @@ type ClientConfig struct {
 	// opentracing
 	EnableTracing bool
 	Tracing       *Tracing
+	// prometheus metrics
+	EnableMetrics bool
 	// insecure
 	EnableTLS bool
 	TLSCert   *TLSCert
+	// timeout, retry & hedging per method
+	Methods []*MethodConfig
+	// load balancing across backends (GRPC.Host & GRPC.Port unused):
+	// static endpoints (host:port) or resolver target, eg. dns:///user:9090
+	Endpoints []string
+	Target    string
+	// round_robin | least_request | pick_first (default)
+	LoadBalancingPolicy string
+	// drop unhealthy backends via grpc.health.v1.Health
+	HealthCheck *ClientHealthCheck
+	// fail fast while downstream keeps failing
+	CircuitBreaker *CircuitBreaker
+	// discover backends, dial registry:///<service> (default target w/o Target & Endpoints)
+	Registry *Registry
+}
+
+// service registry & discovery
+type Registry struct {
+	// consul | static | memory
+	Backend string
+	// consul agent, registered instance (ID, Name, Tag, GRPCHost, GRPCPort) of any backend
+	Consul *Consul
+	// static: service name -> host:port addresses, host names resolved via DNS
+	Services map[string][]string
+	// static: polling interval of DNS while watching
+	RefreshInterval time.Duration
+}
+
+// circuit breaker per target & method
+type CircuitBreaker struct {
+	// open when failures / requests >= FailureRatio (0.5 = 50%) w at least MinRequests in Interval
+	FailureRatio float64
+	MinRequests  int
+	// window of counts while closed, reset once elapsed (default 60s)
+	Interval time.Duration
+	// time spent open before letting probe requests through (half-open)
+	CoolDown time.Duration
+	// successful probes closing the breaker
+	HalfOpenRequests int
+	// grpc code names counted as failures, default UNAVAILABLE, DEADLINE_EXCEEDED, INTERNAL, UNKNOWN, RESOURCE_EXHAUSTED
+	FailureStatusCodes []string
+}
+
+// client side health checking per backend
+type ClientHealthCheck struct {
+	// checked service name, empty: whole server
+	ServiceName string
+}
+
+// call policy of client methods
+type MethodConfig struct {
+	// full method names (/api_v3.UserService/Login), service (/api_v3.UserService/) or default (*)
+	Name []string
+	// default deadline when caller sets none
+	Timeout time.Duration
+	// retry failed calls sequentially
+	Retry *RetryPolicy
+	// send parallel calls, first success wins (idempotent methods only), exclusive w Retry
+	Hedging *HedgingPolicy
+}
+
+type RetryPolicy struct {
+	// total attempts including the original call
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// randomize backoff by +/- Jitter (0.2 = 20%)
+	Jitter float64
+	// grpc code names, eg. UNAVAILABLE
+	RetryableStatusCodes []string
+}
+
+type HedgingPolicy struct {
+	// total attempts including the original call
+	MaxAttempts int
+	// delay before sending the next attempt
+	HedgingDelay time.Duration
+	// grpc code names that let pending attempts continue, other errors are returned
+	NonFatalStatusCodes []string
 }
 
 // opentracing with jaeger
@@ -63,6 +162,9 @@ type TLSCert struct {
 	CACert  string
 	CertPem string
 	KeyPem  string
+	// server: client certificate auth none | request | require, verified w CACert
+	// client: CertPem & KeyPem presented as client certificate
+	ClientAuth string
 }
 
 // grpc-server
@@ -73,6 +175,34 @@ type GRPC struct {
 	MaxCallSendMsgSize int
 }
 
+// admin http server: debug endpoints & metrics, loopback unless Host is set
+type Admin struct {
+	Host string
+	Port int
+	// separate listener serving /metrics only, eg. 0.0.0.0 for prometheus of the docker network
+	// 0: metrics served along debug endpoints on Port
+	MetricsHost string
+	MetricsPort int
+}
+
+// grpc health checking: probe dependencies every interval
+type HealthCheck struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// token bucket rate limit of a grpc method
+type RateLimit struct {
+	// full method name, eg. /api_v3.UserService/Login
+	Method string
+	// bucket key: user (jwt subject) | peer (client ip) | global
+	Key string
+	// tokens refilled per second
+	Rate float64
+	// bucket size
+	Burst int
+}
+
 // grpc-gateway proxy
 type Proxy struct {
 	Host string
@@ -107,12 +237,41 @@ type JWT struct {
 }
 
 type Redis struct {
+	// standalone: 1st node, host:port or redis:// url
+	// sentinel: sentinel addresses, cluster: seed nodes
 	Nodes  []string
 	Prefix string
+	// standalone (default) | sentinel | cluster
+	Mode string
+	// sentinel: name of the monitored master
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	// ignored by cluster
+	DB int
+	// connections per node, 0 uses 10 per cpu
+	PoolSize     int
+	MinIdleConns int
+	EnableTLS    bool
+	TLSCert      *TLSCert
 }
 
 type Cache struct {
+	// redis (default) | memory | tiered (memory in front of redis)
+	Type string
+	// max entries in memory
 	Size int
+	// ttl of cached values
+	Expiration time.Duration
+	// tiered: ttl of the memory tier, shorter keeps replicas consistent
+	LocalExpiration time.Duration
+	// json (default) | msgpack | proto
+	Codec string
+	// ttl of not found markers, negative disables
+	NegativeExpiration time.Duration
+	// tiered: redis pub/sub channel evicting local tiers of every instance
+	InvalidationChannel string
 }
 
 // db
@@ -122,8 +281,10 @@ type Cache struct {
 // 	MongoDB *MongoDB
 // }
 
-// mysql
+// sql db
 type Database struct {
+	// postgres (default), mysql or sqlite: scheme is the db file, ":memory:" by default
+	Driver         string
 	Host           string
 	Port           string
 	User           string
@@ -133,6 +294,14 @@ type Database struct {
 	MaxIdleConns   int
 	MaxOpenConns   int
 	ConnectTimeout time.Duration
+	// read replicas host[:port], primary credentials & scheme
+	Replicas []string
+	// replica health check, unhealthy replicas fail over to primary (default 10s)
+	ReplicaCheckInterval time.Duration
+	// dev only: gorm AutoMigrate models on boot instead of `migrate up`
+	AutoMigrate bool
+	// applied migrations, services sharing a db need their own (default schema_migrations)
+	MigrationsTable string
 }
 
 // mongodb
@@ -162,6 +331,18 @@ type ManagerClient struct {
 	Authentication *Authentication
 	// jwt token
 	RefreshDuration time.Duration
+	// insecure
+	EnableTLS bool
+	TLSCert   *TLSCert
+	// background health probing of idle connections, disabled w negative interval
+	HealthCheck *PoolHealthCheck
+}
+
+type PoolHealthCheck struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	// max delay between probes of a down host
+	MaxBackoff time.Duration
 }
 
 type Authentication struct {
@@ -180,12 +361,15 @@ type Log struct {
 
 // Consul config
 type Consul struct {
-	AddressConsul                  string
-	ID                             string
-	Name                           string
-	Tag                            string
-	GRPCPort                       int
-	GRPCHost                       string
+	// http api address of the agent, eg. localhost:8500
+	AddressConsul string
+	// registered instance, default: <Name>-<GRPCHost>-<GRPCPort>, ServiceName, hostname & GRPC.Port
+	ID       string
+	Name     string
+	Tag      string
+	GRPCPort int
+	GRPCHost string
+	// grpc health check interval & removal of critical instance (seconds)
 	Interval                       int
 	DeregisterCriticalServiceAfter int
 	SessionTimeout                 string
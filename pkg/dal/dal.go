@@ -1 +1,66 @@
+// Package dal picks the gorm backed data access layer of configs.Database.Driver
 package dal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/mysql"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/sqlite"
+)
+
+// drivers
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// DataAccessLayer is a connected sql db
+type DataAccessLayer interface {
+	GetDatabase() *gorm.DB
+	Transaction(ctx context.Context, trans func(tx *gorm.DB) error) error
+	Disconnect() error
+	Ping(ctx context.Context) error
+	Stats() sql.DBStats
+}
+
+var (
+	_ DataAccessLayer = (*postgres.DataAccessLayer)(nil)
+	_ DataAccessLayer = (*mysql.DataAccessLayer)(nil)
+	_ DataAccessLayer = (*sqlite.DataAccessLayer)(nil)
+)
+
+// NewDataAccessLayer connects cfg.Driver, postgres by default
+func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (DataAccessLayer, error) {
+	var (
+		dal DataAccessLayer
+		err error
+	)
+	// w/o typed nil on error
+	switch cfg.Driver {
+	case "", DriverPostgres:
+		var pg *postgres.DataAccessLayer
+		if pg, err = postgres.NewDataAccessLayer(ctx, cfg); err == nil {
+			dal = pg
+		}
+	case DriverMySQL:
+		var my *mysql.DataAccessLayer
+		if my, err = mysql.NewDataAccessLayer(ctx, cfg); err == nil {
+			dal = my
+		}
+	case DriverSQLite:
+		var lite *sqlite.DataAccessLayer
+		if lite, err = sqlite.NewDataAccessLayer(ctx, cfg); err == nil {
+			dal = lite
+		}
+	default:
+		err = fmt.Errorf("dal: unknown driver %q", cfg.Driver)
+	}
+	return dal, err
+}
@@ -0,0 +1,32 @@
+package dal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+func TestNewDataAccessLayer(t *testing.T) {
+	ctx := context.Background()
+	dal, err := NewDataAccessLayer(ctx, &configs.Database{Driver: DriverSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.Ping(ctx); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+	if err := dal.Disconnect(); err != nil {
+		t.Errorf("Disconnect() error = %v", err)
+	}
+
+	dal, err = NewDataAccessLayer(ctx, &configs.Database{Driver: "oracle"})
+	if err == nil || dal != nil {
+		t.Errorf("NewDataAccessLayer() unknown driver = %v, %v", dal, err)
+	}
+	// unreachable mysql: no typed nil
+	dal, err = NewDataAccessLayer(ctx, &configs.Database{Driver: DriverMySQL, Host: "127.0.0.1", Port: "1"})
+	if err == nil || dal != nil {
+		t.Errorf("NewDataAccessLayer() unreachable = %v, %v", dal, err)
+	}
+}
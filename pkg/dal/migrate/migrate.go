@@ -0,0 +1,381 @@
+// Package migrate applies versioned up/down sql migrations tracked in a table,
+// one runner at a time across replicas under a postgres advisory lock
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+)
+
+const DefaultTable = "schema_migrations"
+
+var (
+	ErrInvalidTable = errors.New("migrate: invalid table name")
+	// applied migration file was edited, add a new migration instead
+	ErrChecksumMismatch = errors.New("migrate: checksum mismatch")
+	// applied version has no file, eg. migration of a newer release
+	ErrUnknownVersion  = errors.New("migrate: applied version not found")
+	ErrNoDownMigration = errors.New("migrate: down migration missing")
+
+	// <version>_<name>.up.sql | <version>_<name>.down.sql
+	fileRegexp  = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	tableRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Migration is a version w up & down sql, checksum of up
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status of a migration, applied w checksum of the file at apply time
+type Status struct {
+	*Migration
+	Applied   bool
+	AppliedAt time.Time
+	// file edited since applied
+	Modified bool
+}
+
+type Option func(*Migrator) error
+
+func WithTable(table string) Option {
+	return func(m *Migrator) error {
+		if table == "" {
+			return nil
+		}
+		if !tableRegexp.MatchString(table) {
+			return ErrInvalidTable
+		}
+		m.table = table
+		return nil
+	}
+}
+
+func WithLogger(logger log.Factory) Option {
+	return func(m *Migrator) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	table      string
+	logger     log.Factory
+}
+
+// New loads migrations of fsys root
+func New(db *sql.DB, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		db:     db,
+		table:  DefaultTable,
+		logger: log.DefaultLogger,
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	m.migrations = migrations
+	m.logger = m.logger.With(zap.String("table", m.table))
+	return m, nil
+}
+
+// Load reads migrations of fsys root ordered by version, other files are ignored
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %s & %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", migration.Version)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies pending migrations in order, each in its own transaction
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := Verify(statuses); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				continue
+			}
+			if err := m.apply(ctx, conn, s.Migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, s.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := Verify(statuses); err != nil {
+			return err
+		}
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			if !statuses[i].Applied {
+				continue
+			}
+			if statuses[i].Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, statuses[i].Version, statuses[i].Name)
+			}
+			if err := m.apply(ctx, conn, statuses[i].Migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, statuses[i].Migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists migrations w applied state
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			m.logger.For(ctx).Error("Close conn", zap.Error(err))
+		}
+	}()
+	if err := m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	return m.status(ctx, conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]*Status, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, checksum, applied_at FROM %s", m.table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.logger.For(ctx).Error("Close rows", zap.Error(err))
+		}
+	}()
+	statuses := make([]*Status, len(m.migrations))
+	byVersion := make(map[int64]*Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = &Status{Migration: migration}
+		byVersion[migration.Version] = statuses[i]
+	}
+	for rows.Next() {
+		var version int64
+		var checksum string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		s, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+		s.Applied, s.AppliedAt, s.Modified = true, appliedAt, checksum != s.Checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Verify fails on edited applied migrations, checked before every up & down
+func Verify(statuses []*Status) error {
+	for _, s := range statuses {
+		if s.Modified {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// apply runs up or down sql & records it in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration, up bool) error {
+	logger := m.logger.For(ctx).With(zap.Int64("version", migration.Version), zap.String("name", migration.Name), zap.Bool("up", up))
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	query, record := migration.Up, fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.table)
+	args := []interface{}{migration.Version, migration.Name, migration.Checksum}
+	if !up {
+		query, record = migration.Down, fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table)
+		args = args[:1]
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		logger.Error("Migrate", zap.Error(err))
+		if e := tx.Rollback(); e != nil {
+			logger.Error("Rollback", zap.Error(e))
+		}
+		return fmt.Errorf("migrate: %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		if e := tx.Rollback(); e != nil {
+			logger.Error("Rollback", zap.Error(e))
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Migrated")
+	return nil
+}
+
+// locked runs fn on a connection holding the advisory lock of table
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			m.logger.For(ctx).Error("Close conn", zap.Error(err))
+		}
+	}()
+	lockID := m.lockID()
+	// session lock: blocks until other runners finish
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer func() {
+		// released w/o ctx: lock must not outlive a cancelled run
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			m.logger.For(ctx).Error("Unlock", zap.Error(err))
+		}
+	}()
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version bigint PRIMARY KEY,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`, m.table))
+	return err
+}
+
+// lockID of table, services sharing a db w own tables migrate concurrently
+func (m *Migrator) lockID() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("migrate:" + m.table))
+	return int64(h.Sum64())
+}
+
+// Create writes empty up & down files of name into dir, versioned by now (utc)
+// eg. "Add user role" -> 20210601120000_add_user_role.up.sql
+func Create(dir, name string, now time.Time) ([]string, error) {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("migrate: invalid name %q", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	base := now.UTC().Format("20060102150405") + "_" + strings.Join(fields, "_")
+	files := make([]string, 0, 2)
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, base+"."+direction+".sql")
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return files, err
+		}
+		if _, err := fmt.Fprintf(f, "-- %s: %s\n", direction, name); err != nil {
+			_ = f.Close()
+			return files, err
+		}
+		if err := f.Close(); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"2_add_role.up.sql":     {Data: []byte("ALTER TABLE users ADD role text;")},
+		"2_add_role.down.sql":   {Data: []byte("ALTER TABLE users DROP role;")},
+		"1_create_users.up.sql": {Data: []byte("CREATE TABLE users (id text);")},
+		"migrations.go":         {Data: []byte("package migrations")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_role" {
+		t.Fatalf("Load() = %+v", migrations)
+	}
+	if migrations[0].Down != "" || migrations[1].Down == "" || migrations[0].Checksum == "" {
+		t.Errorf("Load() = %+v, %+v", migrations[0], migrations[1])
+	}
+
+	if _, err := Load(fstest.MapFS{"1_a.down.sql": {}}); err == nil {
+		t.Error("Load() w/o up error = nil")
+	}
+	if _, err := Load(fstest.MapFS{"1_a.up.sql": {}, "1_b.up.sql": {}}); err == nil {
+		t.Error("Load() duplicated version error = nil")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	statuses := []*Status{{Migration: &Migration{Version: 1, Name: "a"}, Applied: true}}
+	if err := Verify(statuses); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	statuses[0].Modified = true
+	if err := Verify(statuses); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	files, err := Create(dir, "Add user role", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "20210601120000_add_user_role.up.sql" {
+		t.Errorf("Create() = %v", files)
+	}
+	if migrations, err := Load(os.DirFS(dir)); err != nil || len(migrations) != 1 {
+		t.Errorf("Load() created = %v, %v", migrations, err)
+	}
+	if _, err := Create(dir, "Add user role", now); err == nil {
+		t.Error("Create() existing error = nil")
+	}
+	if _, err := Create(dir, "!", now); err == nil {
+		t.Error("Create() invalid name error = nil")
+	}
+	if _, err := New(nil, os.DirFS(dir), WithTable("users; DROP TABLE users")); err != ErrInvalidTable {
+		t.Errorf("New() error = %v, want %v", err, ErrInvalidTable)
+	}
+}
@@ -4,25 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"sync"
 
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
-)
-
-//Used to execute client creation procedure only once.
-var once sync.Once
 
-// errors
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
 
 type DataAccessLayer struct {
 	dbConfig *configs.Database
-	//Used during creation of singleton client object in GetMongoClient().
-	dbInstance *sql.DB
+	// Used during creation of singleton client object in GetMongoClient().
+	dbInstance *gorm.DB
+	// Used to execute client creation procedure only once.
+	once sync.Once
 }
 
 func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (*DataAccessLayer, error) {
 	dal := &DataAccessLayer{
 		dbConfig: cfg,
+		once:     sync.Once{},
 	}
 	if _, err := dal.Connect(ctx); err != nil {
 		return nil, err
@@ -31,47 +33,55 @@ func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (*DataAccess
 }
 
 // Build connection string
-func (dal *DataAccessLayer) buildConnectionDSN() (string, error) {
+func (dal *DataAccessLayer) buildConnectionDSN() string {
 	cfg := dal.dbConfig
+	addr := cfg.Host
+	if cfg.Port != "" {
+		addr = net.JoinHostPort(cfg.Host, cfg.Port)
+	}
 	param := "parseTime=true"
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?%s",
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s?%s",
 		cfg.User,
 		cfg.Password,
-		cfg.Host,
+		addr,
 		cfg.Scheme,
 		param,
 	)
-	return dsn, nil
 }
 
 // Connect
-func (dal *DataAccessLayer) Connect(ctx context.Context) (*sql.DB, error) {
-	//Perform connection creation operation only once.
+func (dal *DataAccessLayer) Connect(ctx context.Context) (*gorm.DB, error) {
+	// Perform connection creation operation only once.
 	var err error
-	once.Do(func() {
+	dal.once.Do(func() {
 		// build connection string
-		dsn, e := dal.buildConnectionDSN()
+		dsn := dal.buildConnectionDSN()
+		// connect db
+		db, e := gorm.Open(mysql.Open(dsn), &gorm.Config{})
 		if e != nil {
 			err = e
 			return
 		}
-		// connect db
-		db, e := sql.Open("mysql", dsn)
+
+		// debug
+		if dal.dbConfig.Debug {
+			db = db.Debug()
+		}
+
+		sqlDB, e := db.DB()
 		if e != nil {
 			err = e
 			return
 		}
-		defer db.Close()
-
 		// https://github.com/go-sql-driver/mysql/
 		// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
-		db.SetMaxIdleConns(dal.dbConfig.MaxIdleConns)
+		sqlDB.SetMaxIdleConns(dal.dbConfig.MaxIdleConns)
 
 		// SetMaxOpenConns sets the maximum number of open connections to the database.
-		db.SetMaxOpenConns(dal.dbConfig.MaxOpenConns)
+		sqlDB.SetMaxOpenConns(dal.dbConfig.MaxOpenConns)
 
 		// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
-		db.SetConnMaxLifetime(dal.dbConfig.ConnectTimeout)
+		sqlDB.SetConnMaxLifetime(dal.dbConfig.ConnectTimeout)
 
 		dal.dbInstance = db
 	})
@@ -79,9 +89,35 @@ func (dal *DataAccessLayer) Connect(ctx context.Context) (*sql.DB, error) {
 }
 
 func (dal *DataAccessLayer) Disconnect() error {
-	return dal.dbInstance.Close()
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
-func (dal *DataAccessLayer) GetDatabase() *sql.DB {
+// Ping verifies the connection to the database is still alive
+func (dal *DataAccessLayer) Ping(ctx context.Context) error {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Stats of the connection pool
+func (dal *DataAccessLayer) Stats() sql.DBStats {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+func (dal *DataAccessLayer) GetDatabase() *gorm.DB {
 	return dal.dbInstance
 }
+
+func (dal *DataAccessLayer) Transaction(ctx context.Context, trans func(tx *gorm.DB) error) error {
+	return dal.dbInstance.WithContext(ctx).Transaction(trans)
+}
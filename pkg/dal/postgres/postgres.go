@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"sync"
 
@@ -17,6 +18,11 @@ type DataAccessLayer struct {
 	dbInstance *gorm.DB
 	// Used to execute client creation procedure only once.
 	once sync.Once
+	// read replicas, health checked until Disconnect
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
+	wg       sync.WaitGroup
 }
 
 func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (*DataAccessLayer, error) {
@@ -33,7 +39,11 @@ func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (*DataAccess
 // Build connection string
 func (dal *DataAccessLayer) buildConnectionDSN() string {
 	cfg := dal.dbConfig
-	return fmt.Sprintf("host=%s port=%v user=%s dbname=%s sslmode=disable password=%s", cfg.Host, cfg.Port, cfg.User, cfg.Scheme, cfg.Password)
+	return buildDSN(cfg, cfg.Host, cfg.Port)
+}
+
+func buildDSN(cfg *configs.Database, host, port string) string {
+	return fmt.Sprintf("host=%s port=%v user=%s dbname=%s sslmode=disable password=%s", host, port, cfg.User, cfg.Scheme, cfg.Password)
 }
 
 // Connect
@@ -69,12 +79,19 @@ func (dal *DataAccessLayer) Connect(ctx context.Context) (*gorm.DB, error) {
 		// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 		sqlDB.SetConnMaxLifetime(dal.dbConfig.ConnectTimeout)
 
+		// reads outside transactions go to replicas
+		if e := dal.openReplicas(ctx, db); e != nil {
+			err = e
+			return
+		}
+
 		dal.dbInstance = db
 	})
 	return dal.dbInstance, err
 }
 
 func (dal *DataAccessLayer) Disconnect() error {
+	dal.closeReplicas()
 	sqlDB, err := dal.dbInstance.DB()
 	if err != nil {
 		return err
@@ -82,6 +99,25 @@ func (dal *DataAccessLayer) Disconnect() error {
 	return sqlDB.Close()
 }
 
+// Ping verifies the connection to the database is still alive
+func (dal *DataAccessLayer) Ping(ctx context.Context) error {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Stats of the primary connection pool
+func (dal *DataAccessLayer) Stats() sql.DBStats {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+// GetDatabase returns primary, queries outside transactions are read from replicas w/o WithPrimary
 func (dal *DataAccessLayer) GetDatabase() *gorm.DB {
 	return dal.dbInstance
 }
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"go.uber.org/zap"
+)
+
+// replica health check: interval & ping timeout
+const (
+	defaultReplicaCheckInterval = 10 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+type primaryKey struct{}
+
+// WithPrimary routes reads of ctx to the primary, eg. reading own writes or loading cache
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func isPrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type replica struct {
+	addr    string
+	db      *sql.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	healthy := int32(0)
+	if err == nil {
+		healthy = 1
+	}
+	atomic.StoreInt32(&r.healthy, healthy)
+	return err
+}
+
+// openReplicas connects replicas w primary credentials & routes queries outside transactions to them
+func (dal *DataAccessLayer) openReplicas(ctx context.Context, db *gorm.DB) error {
+	cfg := dal.dbConfig
+	for _, addr := range cfg.Replicas {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, cfg.Port
+		}
+		// w/o ping: down replica must not fail boot
+		replicaDB, err := gorm.Open(postgres.Open(buildDSN(cfg, host, port)), &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			dal.closeReplicas()
+			return err
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			dal.closeReplicas()
+			return err
+		}
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetConnMaxLifetime(cfg.ConnectTimeout)
+		r := &replica{addr: addr, db: sqlDB}
+		// down replica: reads stay on primary until healthy
+		if err := r.check(ctx); err != nil {
+			log.Error("Replica unavailable", zap.String("replica", addr), zap.Error(err))
+		}
+		dal.replicas = append(dal.replicas, r)
+	}
+	if len(dal.replicas) == 0 {
+		return nil
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("dal:replica", dal.routeQuery); err != nil {
+		dal.closeReplicas()
+		return err
+	}
+	dal.stop = make(chan struct{})
+	dal.wg.Add(1)
+	go dal.checkReplicas()
+	return nil
+}
+
+// routeQuery switches reads to a healthy replica, transactions & WithPrimary stay on primary
+func (dal *DataAccessLayer) routeQuery(db *gorm.DB) {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	if isPrimary(db.Statement.Context) {
+		return
+	}
+	if r := dal.replica(); r != nil {
+		db.Statement.ConnPool = r.db
+	}
+}
+
+// replica picks healthy replicas round robin, nil fails over to primary
+func (dal *DataAccessLayer) replica() *replica {
+	n := len(dal.replicas)
+	start := atomic.AddUint32(&dal.next, 1)
+	for i := 0; i < n; i++ {
+		if r := dal.replicas[(int(start)+i)%n]; r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (dal *DataAccessLayer) checkReplicas() {
+	defer dal.wg.Done()
+	interval := dal.dbConfig.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dal.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, r := range dal.replicas {
+			wasHealthy := r.isHealthy()
+			if err := r.check(context.Background()); err != nil && wasHealthy {
+				log.Error("Replica down, reading from primary", zap.String("replica", r.addr), zap.Error(err))
+			} else if err == nil && !wasHealthy {
+				log.Info("Replica up", zap.String("replica", r.addr))
+			}
+		}
+	}
+}
+
+func (dal *DataAccessLayer) closeReplicas() {
+	if dal.stop != nil {
+		close(dal.stop)
+		dal.wg.Wait()
+		dal.stop = nil
+	}
+	for _, r := range dal.replicas {
+		if err := r.db.Close(); err != nil {
+			log.Error("Close replica", zap.String("replica", r.addr), zap.Error(err))
+		}
+	}
+	dal.replicas = nil
+}
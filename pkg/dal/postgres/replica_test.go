@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type fakeTx struct {
+	gorm.ConnPool
+}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func TestRouteQuery(t *testing.T) {
+	// lazily connected pools, never used
+	open := func() *sql.DB {
+		db, err := sql.Open("pgx", "postgres://127.0.0.1:1/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	primary := open()
+	defer func() { _ = primary.Close() }()
+	a, b := &replica{addr: "a", db: open(), healthy: 1}, &replica{addr: "b", db: open(), healthy: 1}
+	dal := &DataAccessLayer{replicas: []*replica{a, b}}
+	defer dal.closeReplicas()
+
+	route := func(ctx context.Context, pool gorm.ConnPool) gorm.ConnPool {
+		db := &gorm.DB{Statement: &gorm.Statement{Context: ctx, ConnPool: pool}}
+		dal.routeQuery(db)
+		return db.Statement.ConnPool
+	}
+	ctx := context.Background()
+	// round robin
+	if first, second := route(ctx, primary), route(ctx, primary); first == second || first == primary || second == primary {
+		t.Errorf("routeQuery() = %p, %p, want both replicas", first, second)
+	}
+	if got := route(WithPrimary(ctx), primary); got != primary {
+		t.Error("routeQuery() w primary ctx routed to replica")
+	}
+	tx := fakeTx{primary}
+	if got := route(ctx, tx); got != tx {
+		t.Error("routeQuery() in transaction routed to replica")
+	}
+	// fail over
+	a.healthy = 0
+	for i := 0; i < 2; i++ {
+		if got := route(ctx, primary); got != b.db {
+			t.Errorf("routeQuery() = %p, want healthy replica", got)
+		}
+	}
+	b.healthy = 0
+	if got := route(ctx, primary); got != primary {
+		t.Error("routeQuery() w/o healthy replica, want primary")
+	}
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Elector elects a single leader among replicas campaigning for key
+type Elector struct {
+	r      *Redis
+	key    string
+	ttl    time.Duration
+	retry  time.Duration
+	leader int32
+}
+
+// NewElector campaigns w lease ttl, followers retry every ttl/2
+func (r *Redis) NewElector(key string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &Elector{r: r, key: "leader:" + key, ttl: ttl, retry: ttl / 2}
+}
+
+// IsLeader reports whether this replica holds the lease
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns until ctx done, fn runs while leading & its ctx is cancelled on lost leadership
+// fn returning early resigns, the next campaign starts after retry
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) error {
+	for {
+		// not obtained, lost or redis down: campaign again after retry
+		_ = e.r.WithLock(ctx, e.key, func(ctx context.Context, _ *Lock) error {
+			atomic.StoreInt32(&e.leader, 1)
+			defer atomic.StoreInt32(&e.leader, 0)
+			fn(ctx)
+			return nil
+		}, LockTTL(e.ttl))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.retry):
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const defaultLockTTL = 10 * time.Second
+
+var (
+	ErrLockNotObtained = errors.New("redis: lock not obtained")
+	ErrLockNotHeld     = errors.New("redis: lock not held")
+)
+
+type LockOption func(*LockOptions) error
+
+type LockOptions struct {
+	// lease duration, default 10s
+	TTL time.Duration
+	// retry every interval until ctx done, 0 tries once
+	RetryInterval time.Duration
+	// refresh every TTL/3 until Release, ctx done or lease lost
+	// lease is lost once refreshes fail for TTL
+	AutoRenew bool
+}
+
+func LockTTL(ttl time.Duration) LockOption {
+	return func(o *LockOptions) error {
+		o.TTL = ttl
+		return nil
+	}
+}
+
+func LockRetry(interval time.Duration) LockOption {
+	return func(o *LockOptions) error {
+		o.RetryInterval = interval
+		return nil
+	}
+}
+
+func LockAutoRenew() LockOption {
+	return func(o *LockOptions) error {
+		o.AutoRenew = true
+		return nil
+	}
+}
+
+// SET NX PX & increment fencing counter, returns token or 0 when held by other
+var obtainScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+
+// owner only: other owners may hold the key after expiry
+var refreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// Lock is a lease on key, held until released or ttl w/o refresh
+type Lock struct {
+	r     *Redis
+	key   string
+	value string
+	token int64
+	ttl   time.Duration
+
+	once   sync.Once
+	lost   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Obtain locks key, ErrLockNotObtained when held by other until retries end
+func (r *Redis) Obtain(ctx context.Context, key string, opts ...LockOption) (*Lock, error) {
+	lOpts := LockOptions{TTL: defaultLockTTL}
+	for _, opt := range opts {
+		if err := opt(&lOpts); err != nil {
+			return nil, err
+		}
+	}
+	if lOpts.TTL <= 0 {
+		lOpts.TTL = defaultLockTTL
+	}
+	// hash tag: lock & fencing counter share the cluster slot
+	rkey := fmt.Sprintf("%slock:{%s}", r.prefix, key)
+	l := &Lock{
+		r:     r,
+		key:   rkey,
+		value: uuid.New().String(),
+		ttl:   lOpts.TTL,
+		lost:  make(chan struct{}),
+	}
+	var obtained time.Time
+	for {
+		// lease starts before SET, not after the reply
+		obtained = time.Now()
+		token, err := obtainScript.Run(ctx, r.client, []string{rkey, rkey + ":fence"}, l.value, l.ttl.Milliseconds()).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if token > 0 {
+			l.token = token
+			break
+		}
+		if lOpts.RetryInterval <= 0 {
+			return nil, ErrLockNotObtained
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockNotObtained
+		case <-time.After(lOpts.RetryInterval):
+		}
+	}
+	if lOpts.AutoRenew {
+		l.autoRenew(ctx, obtained)
+	}
+	return l, nil
+}
+
+// Token is the fencing token, increases w each obtain of key
+// writes guarded by lock should reject tokens lower than the last seen
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Lost is closed once the lease is lost or released
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh extends the lease to ttl, 0 uses obtain ttl
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = l.ttl
+	}
+	ok, err := refreshScript.Run(ctx, l.r.client, []string{l.key}, l.value, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		l.markLost()
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release deletes the key if still owned, ErrLockNotHeld after expiry
+func (l *Lock) Release(ctx context.Context) error {
+	if l.cancel != nil {
+		l.cancel()
+		l.wg.Wait()
+	}
+	defer l.markLost()
+	ok, err := releaseScript.Run(ctx, l.r.client, []string{l.key}, l.value).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// autoRenew refreshes in background until Release, ctx done or lease lost
+// lastRefresh: start of the current lease
+func (l *Lock) autoRenew(ctx context.Context, lastRefresh time.Time) {
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			start := time.Now()
+			err := l.Refresh(ctx, 0)
+			switch {
+			case err == nil:
+				lastRefresh = start
+			case err == ErrLockNotHeld:
+				return
+			case time.Since(lastRefresh) >= l.ttl:
+				// redis unreachable for ttl: key may be expired & obtained by other
+				l.markLost()
+				return
+			}
+			// transient errors retried on next tick while lease lasts
+		}
+	}()
+}
+
+func (l *Lock) markLost() {
+	l.once.Do(func() {
+		close(l.lost)
+	})
+}
+
+// WithLock runs fn holding key w auto renew, ctx of fn is cancelled if the lease is lost
+// fn should fence its writes w the lock token: cancel is observed asynchronously
+func (r *Redis) WithLock(ctx context.Context, key string, fn func(ctx context.Context, l *Lock) error, opts ...LockOption) error {
+	l, err := r.Obtain(ctx, key, append(opts, LockAutoRenew())...)
+	if err != nil {
+		return err
+	}
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+	err = fn(fnCtx, l)
+	// released w/o caller ctx: cancelled requests still free the key
+	if e := l.Release(context.Background()); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -1,7 +1,11 @@
 package redis
 
 import (
+	"crypto/tls"
 	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 )
 
 type Option func(*Redis) error
@@ -20,18 +24,96 @@ func WithPrefix(prefix string) Option {
 	}
 }
 
+// WithConfig sets nodes, prefix & topology of config
+func WithConfig(config *configs.Redis) Option {
+	return func(r *Redis) error {
+		if config == nil {
+			return nil
+		}
+		r.nodes = config.Nodes
+		if config.Prefix != "" {
+			r.prefix = config.Prefix
+		}
+		r.mode = config.Mode
+		r.options.MasterName = config.MasterName
+		r.options.Username = config.Username
+		r.options.Password = config.Password
+		r.options.SentinelPassword = config.SentinelPassword
+		r.options.DB = config.DB
+		r.options.PoolSize = config.PoolSize
+		r.options.MinIdleConns = config.MinIdleConns
+		if !config.EnableTLS {
+			return nil
+		}
+		if config.TLSCert == nil || config.TLSCert.CACert == "" {
+			// verified w system roots
+			r.options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			return nil
+		}
+		tlsConfig, err := utils.LoadClientTLSConfigWithCert(config.TLSCert.CACert, config.TLSCert.CertPem, config.TLSCert.KeyPem)
+		if err != nil {
+			return err
+		}
+		r.options.TLSConfig = tlsConfig
+		return nil
+	}
+}
+
 type ReadOption func(*ReadOptions) error
 
 type ReadOptions struct {
 	Prefix string
-	Limit  int
+	// prefix reads: max records, 0 reads all
+	Limit int
+	// prefix reads: records skipped
 	Offset int
+	// prefix reads: resume from cursor of ReadPage or Iterator
+	Cursor string
+	// prefix reads: keys per SCAN & pipelined GET/TTL
+	BatchSize int
+}
+
+func ReadLimit(limit int) ReadOption {
+	return func(o *ReadOptions) error {
+		o.Limit = limit
+		return nil
+	}
+}
+
+func ReadOffset(offset int) ReadOption {
+	return func(o *ReadOptions) error {
+		o.Offset = offset
+		return nil
+	}
+}
+
+func ReadCursor(cursor string) ReadOption {
+	return func(o *ReadOptions) error {
+		o.Cursor = cursor
+		return nil
+	}
+}
+
+func ReadBatchSize(size int) ReadOption {
+	return func(o *ReadOptions) error {
+		o.BatchSize = size
+		return nil
+	}
 }
 
 type DeleteOption func(*DeleteOptions) error
 
 type DeleteOptions struct {
 	Prefix string
+	// prefix deletes: keys per SCAN & UNLINK
+	BatchSize int
+}
+
+func DeleteBatchSize(size int) DeleteOption {
+	return func(o *DeleteOptions) error {
+		o.BatchSize = size
+		return nil
+	}
 }
 
 type WriteOption func(*WriteOptions) error
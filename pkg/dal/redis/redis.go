@@ -12,13 +12,26 @@ import (
 
 //ctx context to be used when interacting with Redis
 var ctx = context.Background()
-var once sync.Once
+
+// topologies
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+var ErrMasterNameRequired = errors.New("redis: sentinel requires master name")
 
 // rkv is the struct that handles the client connected to Redis
 type Redis struct {
-	nodes  []string
-	prefix string
-	client *redis.Client
+	nodes   []string
+	prefix  string
+	mode    string
+	options redis.UniversalOptions
+	// each instance owns its connection
+	once   sync.Once
+	err    error
+	client redis.UniversalClient
 }
 
 //NewStore creates and returns a rkv redis object
@@ -35,107 +48,163 @@ func New(opts ...Option) (*Redis, error) {
 	return r, nil
 }
 
-//configure set the address of the redis instance
+//configure creates client of the configured topology
 func (r *Redis) configure() error {
-	var redisOptions *redis.Options
 	nodes := r.nodes
 	if len(nodes) == 0 {
 		nodes = []string{"redis://127.0.0.1:6379"}
 	}
 
-	redisOptions, err := redis.ParseURL(nodes[0])
+	switch r.mode {
+	case "", ModeStandalone:
+		r.client = redis.NewClient(r.standaloneOptions(nodes[0]))
+	case ModeSentinel:
+		if r.options.MasterName == "" {
+			return ErrMasterNameRequired
+		}
+		options := r.options
+		options.Addrs = addrs(nodes)
+		r.client = redis.NewFailoverClient(options.Failover())
+	case ModeCluster:
+		options := r.options
+		options.Addrs = addrs(nodes)
+		r.client = redis.NewClusterClient(options.Cluster())
+	default:
+		return fmt.Errorf("unknown redis mode: %q", r.mode)
+	}
+	return nil
+}
+
+// standaloneOptions parses url node, configured auth, db, pool & tls take precedence
+func (r *Redis) standaloneOptions(node string) *redis.Options {
+	redisOptions, err := redis.ParseURL(node)
 	if err != nil {
 		//Backwards compatibility
-		redisOptions = &redis.Options{
-			Addr:        nodes[0],
-			Password:    "",          // no password set
-			DB:          0,           // use default DB
-			PoolTimeout: time.Minute, //
-		}
+		options := r.options
+		options.Addrs = []string{node}
+		options.PoolTimeout = time.Minute
+		return options.Simple()
 	}
+	if r.options.Username != "" {
+		redisOptions.Username = r.options.Username
+	}
+	if r.options.Password != "" {
+		redisOptions.Password = r.options.Password
+	}
+	if r.options.DB != 0 {
+		redisOptions.DB = r.options.DB
+	}
+	if r.options.PoolSize > 0 {
+		redisOptions.PoolSize = r.options.PoolSize
+	}
+	if r.options.MinIdleConns > 0 {
+		redisOptions.MinIdleConns = r.options.MinIdleConns
+	}
+	if r.options.TLSConfig != nil {
+		redisOptions.TLSConfig = r.options.TLSConfig
+	}
+	return redisOptions
+}
 
-	r.client = redis.NewClient(redisOptions)
-	return nil
+// addrs converts url nodes to host:port
+func addrs(nodes []string) []string {
+	addrs := make([]string, len(nodes))
+	for i, node := range nodes {
+		if options, err := redis.ParseURL(node); err == nil {
+			node = options.Addr
+		}
+		addrs[i] = node
+	}
+	return addrs
 }
 
 // Connect
 func (r *Redis) Connect() error {
 	//Perform connection creation operation only once.
-	var e error
-	once.Do(func() {
-		if err := r.configure(); err != nil {
-			e = err
-			return
-		}
+	r.once.Do(func() {
+		r.err = r.configure()
 	})
-	return e
+	return r.err
 }
 
-// get redis client
-func (r *Redis) GetClient() *redis.Client {
+// get redis client: *redis.Client, *redis.ClusterClient or failover client
+func (r *Redis) GetClient() redis.UniversalClient {
 	if err := r.Connect(); err != nil {
 		return nil
 	}
 	return r.client
 }
 
+// IsCluster reports whether keys of multi-key commands must share a hash slot
+func (r *Redis) IsCluster() bool {
+	_, ok := r.client.(*redis.ClusterClient)
+	return ok
+}
+
+// Ping verifies the connection to Redis is still alive
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 //Close ends the connection to Redis
 func (r *Redis) Close() error {
 	return r.client.Close()
 }
 
 //Read retrieves data from Redis based on a given key
+// w prefix, records of keys starting w key are scanned, see ReadPage
 func (r *Redis) Read(key string, opts ...ReadOption) ([]*Record, error) {
+	records, _, err := r.ReadPage(key, opts...)
+	return records, err
+}
+
+// ReadPage reads as Read & returns cursor of the next page, empty when done
+func (r *Redis) ReadPage(key string, opts ...ReadOption) ([]*Record, string, error) {
 	var rOpts ReadOptions
 	rOpts.Prefix = r.prefix
 	for _, opt := range opts {
 		if err := opt(&rOpts); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	var keys []string
 	rkey := fmt.Sprintf("%s%s", rOpts.Prefix, key)
 	// Handle Prefix
 	// TODO suffix
 	if r.prefix != "" {
-		prefixKey := fmt.Sprintf("%s*", rkey)
-		fkeys, err := r.client.Keys(ctx, prefixKey).Result()
-		if err != nil {
-			return nil, err
+		it := r.scan(ctx, rkey, rOpts)
+		var records []*Record
+		for it.Next() {
+			records = append(records, it.Record())
+		}
+		if err := it.Err(); err != nil {
+			return nil, "", err
 		}
-		// TODO Limit Offset
-		keys = append(keys, fkeys...)
-	} else {
-		keys = []string{rkey}
+		return records, it.Cursor(), nil
 	}
 
-	records := make([]*Record, 0, len(keys))
-	for _, rkey = range keys {
-		val, err := r.client.Get(ctx, rkey).Bytes()
-
-		if err != nil && err == redis.Nil {
-			return nil, errors.New("not found")
-		} else if err != nil {
-			return nil, err
-		}
-		if val == nil {
-			return nil, errors.New("not found")
-		}
-		d, err := r.client.TTL(ctx, rkey).Result()
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, &Record{
-			Key:    key,
-			Value:  val,
-			Expiry: d,
-		})
+	val, err := r.client.Get(ctx, rkey).Bytes()
+	if err != nil && err == redis.Nil {
+		return nil, "", errors.New("not found")
+	} else if err != nil {
+		return nil, "", err
+	}
+	if val == nil {
+		return nil, "", errors.New("not found")
+	}
+	d, err := r.client.TTL(ctx, rkey).Result()
+	if err != nil {
+		return nil, "", err
 	}
-	return records, nil
+	return []*Record{{
+		Key:    key,
+		Value:  val,
+		Expiry: d,
+	}}, "", nil
 }
 
 //Delete removes data from Redis based on the given Key
+// w prefix, keys starting w key are scanned & unlinked in batches
 func (r *Redis) Del(key string, opts ...DeleteOption) error {
 	var dOpts DeleteOptions
 	dOpts.Prefix = r.prefix
@@ -144,22 +213,32 @@ func (r *Redis) Del(key string, opts ...DeleteOption) error {
 			return err
 		}
 	}
-	var keys []string
 	rkey := fmt.Sprintf("%s%s", dOpts.Prefix, key)
 	// Handle Prefix
 	// TODO suffix
 	if r.prefix != "" {
-		prefixKey := fmt.Sprintf("%s*", rkey)
-		fkeys, err := r.client.Keys(ctx, prefixKey).Result()
-		if err != nil {
-			return err
-		}
-		// TODO Limit Offset
-		keys = append(keys, fkeys...)
-	} else {
-		keys = []string{rkey}
+		return r.scanKeys(ctx, rkey, int64(dOpts.BatchSize), func(keys []string) error {
+			return r.unlink(ctx, keys...)
+		})
 	}
-	return r.client.Del(ctx, keys...).Err()
+	return r.client.Del(ctx, rkey).Err()
+}
+
+// unlink frees keys in background, one by one in cluster: keys may live in different slots
+func (r *Redis) unlink(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if !r.IsCluster() {
+		return r.client.Unlink(ctx, keys...).Err()
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Unlink(ctx, key)
+		}
+		return nil
+	})
+	return err
 }
 
 //Write save data to redis
@@ -238,3 +317,46 @@ func (r *Redis) LPush(record *Record, opts ...WriteOption) error {
 	}
 	return r.client.Expire(ctx, rkey, record.Expiry).Err()
 }
+
+/**
+* TOKEN BUCKET
+ */
+// tokens refill at rate/s up to burst, 1 token taken per call
+// returns allowed, wait (ms) until the next token
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+// TakeToken takes a token from bucket key shared by all replicas
+func (r *Redis) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	rkey := fmt.Sprintf("%s%s", r.prefix, key)
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{rkey}, rate, burst, now).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return false, 0, fmt.Errorf("unexpected token bucket result: %v", res)
+	}
+	allowed, _ := vals[0].(int64)
+	wait, _ := vals[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
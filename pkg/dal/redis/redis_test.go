@@ -0,0 +1,520 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/go-redis/redis/v8"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+func TestNew(t *testing.T) {
+	// clients connect lazily: no server needed
+	standalone, err := New(WithConfig(&configs.Redis{
+		Nodes:    []string{"redis://:old@127.0.0.1:1/2"},
+		Password: "pass",
+		PoolSize: 3,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = standalone.Close() }()
+	client, ok := standalone.GetClient().(*redis.Client)
+	if !ok {
+		t.Fatalf("standalone client = %T", standalone.GetClient())
+	}
+	if opts := client.Options(); opts.Addr != "127.0.0.1:1" || opts.Password != "pass" || opts.DB != 2 || opts.PoolSize != 3 {
+		t.Errorf("standalone options = %+v", opts)
+	}
+
+	// each instance owns its connection
+	other, err := New(WithNodes([]string{"127.0.0.1:2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Close() }()
+	if other.GetClient() == standalone.GetClient() {
+		t.Error("New() shares client")
+	}
+
+	cluster, err := New(WithConfig(&configs.Redis{Mode: ModeCluster, Nodes: []string{"redis://127.0.0.1:1", "127.0.0.1:2"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cluster.Close() }()
+	if !cluster.IsCluster() || standalone.IsCluster() {
+		t.Error("IsCluster() mismatch")
+	}
+	if addrs := cluster.GetClient().(*redis.ClusterClient).Options().Addrs; len(addrs) != 2 || addrs[0] != "127.0.0.1:1" {
+		t.Errorf("cluster addrs = %v", addrs)
+	}
+
+	if _, err := New(WithConfig(&configs.Redis{Mode: ModeSentinel, Nodes: []string{"127.0.0.1:26379"}})); err != ErrMasterNameRequired {
+		t.Errorf("New() sentinel w/o master error = %v, want %v", err, ErrMasterNameRequired)
+	}
+	sentinel, err := New(WithConfig(&configs.Redis{Mode: ModeSentinel, MasterName: "master", Nodes: []string{"127.0.0.1:26379"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sentinel.Close()
+	if _, err := New(WithConfig(&configs.Redis{Mode: "ring"})); err == nil {
+		t.Error("New() unknown mode error = nil")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	node, cursor, skip, err := parseCursor(formatCursor(1, 42, 3))
+	if err != nil || node != 1 || cursor != 42 || skip != 3 {
+		t.Errorf("parseCursor() = %d, %d, %d, %v", node, cursor, skip, err)
+	}
+	if node, cursor, skip, err := parseCursor(""); err != nil || node != 0 || cursor != 0 || skip != 0 {
+		t.Errorf("parseCursor() empty = %d, %d, %d, %v", node, cursor, skip, err)
+	}
+	for _, s := range []string{"x", "1-2", "-1-0-0"} {
+		if _, _, _, err := parseCursor(s); err != ErrInvalidCursor {
+			t.Errorf("parseCursor(%q) error = %v, want %v", s, err, ErrInvalidCursor)
+		}
+	}
+
+	r, err := New(WithNodes([]string{"127.0.0.1:1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	it := r.Scan(context.Background(), "user", ReadCursor("x"))
+	if it.Next() || it.Err() != ErrInvalidCursor {
+		t.Errorf("Scan() invalid cursor error = %v, want %v", it.Err(), ErrInvalidCursor)
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	if got, want := escapeGlob(`a*b?[c]\`), `a\*b\?\[c\]\\`; got != want {
+		t.Errorf("escapeGlob() = %s, want %s", got, want)
+	}
+}
+
+func TestLock_Unavailable(t *testing.T) {
+	r, err := New(WithConfig(&configs.Redis{Nodes: []string{"127.0.0.1:1"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	called := false
+	if err := r.WithLock(ctx, "a", func(ctx context.Context, _ *Lock) error { called = true; return nil }); err == nil || called {
+		t.Errorf("WithLock() error = %v, called %v", err, called)
+	}
+	// followers keep campaigning until ctx done
+	e := r.NewElector("jobs", 20*time.Millisecond)
+	if err := e.Run(ctx, func(ctx context.Context) { called = true }); err != context.DeadlineExceeded || called || e.IsLeader() {
+		t.Errorf("Run() error = %v, called %v", err, called)
+	}
+}
+
+// newMiniRedis serves r on miniredis, keys are written w prefix
+func newMiniRedis(t *testing.T, prefix string) (*miniredis.Miniredis, *Redis) {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	r, err := New(WithNodes([]string{m.Addr()}), WithPrefix(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return m, r
+}
+
+// writeUsers writes user:00..user:n-1 & a key out of prefix
+func writeUsers(t *testing.T, m *miniredis.Miniredis, n int) []string {
+	t.Helper()
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%02d", i)
+		if err := m.Set("app:"+keys[i], keys[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Set("app:order:1", "order"); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func recordKeys(records []*Record) []string {
+	keys := make([]string, len(records))
+	for i, record := range records {
+		keys[i] = record.Key
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalKeys(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScan(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	users := writeUsers(t, m, 25)
+	m.SetTTL("app:user:00", time.Minute)
+
+	it := r.Scan(context.Background(), "user:", ReadBatchSize(4))
+	var records []*Record
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordKeys(records); !equalKeys(got, users) {
+		t.Errorf("Scan() keys = %v, want %v", got, users)
+	}
+	for _, record := range records {
+		if string(record.Value.([]byte)) != record.Key {
+			t.Errorf("Scan() %s value = %s", record.Key, record.Value)
+		}
+		if record.Key == "user:00" && record.Expiry != time.Minute {
+			t.Errorf("Scan() %s expiry = %v, want %v", record.Key, record.Expiry, time.Minute)
+		}
+	}
+	if it.Cursor() != "" {
+		t.Errorf("Cursor() done = %q, want empty", it.Cursor())
+	}
+
+	// glob chars of prefix are literal
+	if err := m.Set("app:us*r", "glob"); err != nil {
+		t.Fatal(err)
+	}
+	it = r.Scan(context.Background(), "us*")
+	for it.Next() {
+		if key := it.Record().Key; key != "us*r" {
+			t.Errorf("Scan() glob prefix key = %s", key)
+		}
+	}
+}
+
+func TestReadPage(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	users := writeUsers(t, m, 25)
+
+	records, _, err := r.ReadPage("user:", ReadLimit(7))
+	if err != nil || len(records) != 7 {
+		t.Fatalf("ReadPage() limit = %d records, %v, want 7", len(records), err)
+	}
+	records, _, err = r.ReadPage("user:", ReadOffset(20))
+	if err != nil || len(records) != 5 {
+		t.Fatalf("ReadPage() offset = %d records, %v, want 5", len(records), err)
+	}
+
+	// resume w cursor: every key once
+	var all []*Record
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(users) {
+			t.Fatal("ReadPage() cursor never done")
+		}
+		records, next, err := r.ReadPage("user:", ReadLimit(7), ReadCursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != "" && len(records) != 7 {
+			t.Errorf("ReadPage() page %d = %d records, want 7", pages, len(records))
+		}
+		all = append(all, records...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if got := recordKeys(all); !equalKeys(got, users) {
+		t.Errorf("ReadPage() pages keys = %v, want %v", got, users)
+	}
+
+	// keys expired between pages are skipped, not repeated
+	first, cursor, err := r.ReadPage("user:", ReadLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, record := range first {
+		seen[record.Key] = true
+	}
+	var expired string
+	for _, key := range users {
+		if !seen[key] {
+			expired = key
+			break
+		}
+	}
+	m.SetTTL("app:"+expired, time.Second)
+	m.FastForward(2 * time.Second)
+	rest, next, err := r.ReadPage("user:", ReadCursor(cursor))
+	if err != nil || next != "" {
+		t.Fatalf("ReadPage() rest cursor = %q, %v", next, err)
+	}
+	for _, record := range rest {
+		if seen[record.Key] || record.Key == expired {
+			t.Errorf("ReadPage() rest repeats %s", record.Key)
+		}
+		seen[record.Key] = true
+	}
+	if len(seen) != len(users)-1 {
+		t.Errorf("ReadPage() read %d keys, want %d", len(seen), len(users)-1)
+	}
+}
+
+func TestReadKeys_Expired(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	writeUsers(t, m, 4)
+	keys := []string{"app:user:00", "app:user:01", "app:user:02", "app:user:03"}
+
+	// scanned, then expired before read
+	m.SetTTL("app:user:01", time.Second)
+	m.SetTTL("app:user:03", time.Second)
+	m.FastForward(2 * time.Second)
+	records, indexes, err := r.readKeys(context.Background(), keys, "app:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordKeys(records); !equalKeys(got, []string{"user:00", "user:02"}) {
+		t.Errorf("readKeys() keys = %v", got)
+	}
+	// positions in scanned keys for cursors
+	if len(indexes) != 2 || indexes[0] != 0 || indexes[1] != 2 {
+		t.Errorf("readKeys() indexes = %v, want [0 2]", indexes)
+	}
+}
+
+// countHook counts commands by name, pipelined too
+type countHook struct {
+	counts map[string]int
+}
+
+func (h *countHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	h.counts[cmd.Name()]++
+	return ctx, nil
+}
+
+func (h *countHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *countHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		h.counts[cmd.Name()]++
+	}
+	return ctx, nil
+}
+
+func (h *countHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestDel(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	writeUsers(t, m, 25)
+	hook := &countHook{counts: make(map[string]int)}
+	r.GetClient().AddHook(hook)
+
+	if err := r.Del("user:", DeleteBatchSize(4)); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range m.Keys() {
+		if key != "app:order:1" {
+			t.Errorf("Del() kept %s", key)
+		}
+	}
+	// scanned keys freed in background per batch
+	if hook.counts["unlink"] == 0 || hook.counts["unlink"] != hook.counts["scan"] || hook.counts["del"] != 0 {
+		t.Errorf("Del() commands = %v, want unlink per scan", hook.counts)
+	}
+	if err := r.Del("none:"); err != nil {
+		t.Errorf("Del() no keys error = %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	ctx := context.Background()
+
+	l, err := r.Obtain(ctx, "a", LockTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Exists("app:lock:{a}") {
+		t.Errorf("Obtain() keys = %v", m.Keys())
+	}
+	// contended: once, then retried until ctx done
+	if _, err := r.Obtain(ctx, "a"); err != ErrLockNotObtained {
+		t.Errorf("Obtain() held error = %v, want %v", err, ErrLockNotObtained)
+	}
+	retryCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Obtain(retryCtx, "a", LockRetry(10*time.Millisecond)); err != ErrLockNotObtained {
+		t.Errorf("Obtain() retried error = %v, want %v", err, ErrLockNotObtained)
+	}
+	if _, err := r.Obtain(ctx, "b"); err != nil {
+		t.Errorf("Obtain() other key error = %v", err)
+	}
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l.Lost():
+	default:
+		t.Error("Lost() open after Release")
+	}
+	if m.Exists("app:lock:{a}") {
+		t.Error("Release() kept key")
+	}
+
+	// fencing tokens increase w each obtain
+	next, err := r.Obtain(ctx, "a", LockTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Token() <= l.Token() {
+		t.Errorf("Token() = %d, want > %d", next.Token(), l.Token())
+	}
+
+	// expired lease: released or refreshed by its owner only
+	m.FastForward(2 * time.Second)
+	owner, err := r.Obtain(ctx, "a", LockTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Token() <= next.Token() {
+		t.Errorf("Token() = %d, want > %d", owner.Token(), next.Token())
+	}
+	if err := next.Refresh(ctx, 0); err != ErrLockNotHeld {
+		t.Errorf("Refresh() expired error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if err := next.Release(ctx); err != ErrLockNotHeld {
+		t.Errorf("Release() expired error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if _, err := r.Obtain(ctx, "a"); err != ErrLockNotObtained {
+		t.Errorf("Obtain() after other release error = %v, want %v", err, ErrLockNotObtained)
+	}
+	if err := owner.Release(ctx); err != nil {
+		t.Errorf("Release() owner error = %v", err)
+	}
+}
+
+func TestLock_AutoRenew(t *testing.T) {
+	m, r := newMiniRedis(t, "app:")
+	ctx := context.Background()
+
+	ttl := 90 * time.Millisecond
+	l, err := r.Obtain(ctx, "a", LockTTL(ttl), LockAutoRenew())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// miniredis time is frozen: only refreshes reset the ttl
+	m.FastForward(80 * time.Millisecond)
+	time.Sleep(ttl / 2)
+	if got := m.TTL("app:lock:{a}"); got <= 10*time.Millisecond {
+		t.Errorf("TTL() = %v, want refreshed", got)
+	}
+
+	// lost once refreshes fail for ttl
+	m.SetError("down")
+	select {
+	case <-l.Lost():
+	case <-time.After(10 * ttl):
+		t.Error("Lost() open w/o refreshes")
+	}
+	m.SetError("")
+	if err := l.Release(ctx); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+
+	// ctx of fn cancelled on lost lease
+	err = r.WithLock(ctx, "b", func(ctx context.Context, l *Lock) error {
+		if l.Token() <= 0 {
+			t.Errorf("WithLock() token = %d", l.Token())
+		}
+		m.Del("app:lock:{b}")
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * ttl):
+			t.Error("WithLock() ctx not cancelled")
+		}
+		return nil
+	}, LockTTL(ttl))
+	if err != ErrLockNotHeld {
+		t.Errorf("WithLock() lost error = %v, want %v", err, ErrLockNotHeld)
+	}
+}
+
+func TestElector(t *testing.T) {
+	_, r := newMiniRedis(t, "app:")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ttl := 60 * time.Millisecond
+	leaders := make(chan int, 2)
+	resign := [2]chan struct{}{make(chan struct{}), make(chan struct{})}
+	electors := [2]*Elector{r.NewElector("jobs", ttl), r.NewElector("jobs", ttl)}
+	done := make(chan error, 2)
+	for i, e := range electors {
+		i, e := i, e
+		go func() {
+			done <- e.Run(ctx, func(ctx context.Context) {
+				leaders <- i
+				select {
+				case <-ctx.Done():
+				case <-resign[i]:
+				}
+			})
+		}()
+	}
+
+	first := waitLeader(t, leaders)
+	if !electors[first].IsLeader() || electors[1-first].IsLeader() {
+		t.Errorf("IsLeader() = %v, %v, want %d only", electors[0].IsLeader(), electors[1].IsLeader(), first)
+	}
+	// resigned leader hands over to the follower
+	close(resign[first])
+	if second := waitLeader(t, leaders); second != 1-first {
+		t.Errorf("leader after handover = %d, want %d", second, 1-first)
+	}
+	if electors[first].IsLeader() {
+		t.Error("IsLeader() after resign = true")
+	}
+
+	cancel()
+	for range electors {
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+		}
+	}
+}
+
+func waitLeader(t *testing.T, leaders <-chan int) int {
+	t.Helper()
+	select {
+	case i := <-leaders:
+		return i
+	case <-time.After(time.Second):
+		t.Fatal("no leader elected")
+		return -1
+	}
+}
@@ -0,0 +1,280 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// keys per SCAN & per pipelined GET/TTL or UNLINK batch
+const defaultBatchSize = 100
+
+var ErrInvalidCursor = errors.New("redis: invalid cursor")
+
+// Iterator streams records of keys w prefix, scanned & read in batches
+// keys changed during iteration may be missed or returned twice, as SCAN
+type Iterator struct {
+	r      *Redis
+	ctx    context.Context
+	match  string
+	trim   string
+	batch  int64
+	limit  int
+	offset int
+	read   int
+
+	// scanned nodes: client or every master in cluster
+	nodes []redis.Cmdable
+	// position of the next batch
+	node   int
+	cursor uint64
+	skip   int
+
+	// current batch, indexes of records in scanned keys
+	batchNode   int
+	batchCursor uint64
+	records     []*Record
+	indexes     []int
+
+	record *Record
+	err    error
+}
+
+// Scan iterates records of keys starting w prefix
+// Limit, Offset & Cursor of opts are honoured
+func (r *Redis) Scan(ctx context.Context, prefix string, opts ...ReadOption) *Iterator {
+	var rOpts ReadOptions
+	rOpts.Prefix = r.prefix
+	for _, opt := range opts {
+		if err := opt(&rOpts); err != nil {
+			return &Iterator{err: err}
+		}
+	}
+	return r.scan(ctx, rOpts.Prefix+prefix, rOpts)
+}
+
+func (r *Redis) scan(ctx context.Context, rkey string, rOpts ReadOptions) *Iterator {
+	it := &Iterator{
+		r:      r,
+		ctx:    ctx,
+		match:  escapeGlob(rkey) + "*",
+		trim:   rOpts.Prefix,
+		batch:  int64(rOpts.BatchSize),
+		limit:  rOpts.Limit,
+		offset: rOpts.Offset,
+	}
+	if it.batch <= 0 {
+		it.batch = defaultBatchSize
+	}
+	it.node, it.cursor, it.skip, it.err = parseCursor(rOpts.Cursor)
+	return it
+}
+
+// Next advances to the next record, false when done or failed
+func (it *Iterator) Next() bool {
+	for {
+		if it.err != nil || (it.limit > 0 && it.read >= it.limit) {
+			return false
+		}
+		for len(it.records) == 0 {
+			if !it.fetch() {
+				return false
+			}
+		}
+		it.record = it.records[0]
+		it.records, it.indexes = it.records[1:], it.indexes[1:]
+		if it.offset > 0 {
+			it.offset--
+			continue
+		}
+		it.read++
+		return true
+	}
+}
+
+// Record returns the current record
+func (it *Iterator) Record() *Record {
+	return it.record
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Cursor resumes iteration after the current record w ReadCursor, empty when done
+// nodes of the cluster must not change between pages
+func (it *Iterator) Cursor() string {
+	if len(it.records) > 0 {
+		return formatCursor(it.batchNode, it.batchCursor, it.indexes[0])
+	}
+	if it.nodes != nil && it.node >= len(it.nodes) {
+		return ""
+	}
+	return formatCursor(it.node, it.cursor, it.skip)
+}
+
+// fetch scans the next batch & reads its records, false when no batch left
+func (it *Iterator) fetch() bool {
+	if it.nodes == nil {
+		if it.nodes, it.err = it.r.scanNodes(it.ctx); it.err != nil {
+			return false
+		}
+	}
+	if it.node >= len(it.nodes) {
+		return false
+	}
+	node, cursor, skip := it.node, it.cursor, it.skip
+	keys, next, err := it.nodes[node].Scan(it.ctx, cursor, it.match, it.batch).Result()
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if next == 0 {
+		it.node++
+	}
+	it.cursor, it.skip = next, 0
+	if skip > len(keys) {
+		skip = len(keys)
+	}
+	records, indexes, err := it.r.readKeys(it.ctx, keys[skip:], it.trim)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	for i := range indexes {
+		indexes[i] += skip
+	}
+	it.batchNode, it.batchCursor = node, cursor
+	it.records, it.indexes = records, indexes
+	return true
+}
+
+// readKeys pipelines GET & TTL of keys, missing keys are skipped
+func (r *Redis) readKeys(ctx context.Context, keys []string, trim string) ([]*Record, []int, error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	gets := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+			ttls[i] = pipe.TTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+	records := make([]*Record, 0, len(keys))
+	indexes := make([]int, 0, len(keys))
+	for i, key := range keys {
+		val, err := gets[i].Bytes()
+		if err == redis.Nil {
+			// expired or deleted since scanned
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, &Record{
+			Key:    strings.TrimPrefix(key, trim),
+			Value:  val,
+			Expiry: ttls[i].Val(),
+		})
+		indexes = append(indexes, i)
+	}
+	return records, indexes, nil
+}
+
+// scanKeys calls fn w each batch of keys matching rkey*
+func (r *Redis) scanKeys(ctx context.Context, rkey string, batch int64, fn func(keys []string) error) error {
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	nodes, err := r.scanNodes(ctx)
+	if err != nil {
+		return err
+	}
+	match := escapeGlob(rkey) + "*"
+	for _, node := range nodes {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, match, batch).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := fn(keys); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil
+}
+
+// scanNodes returns masters ordered by address in cluster, SCAN is per node
+func (r *Redis) scanNodes(ctx context.Context) ([]redis.Cmdable, error) {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return []redis.Cmdable{r.client}, nil
+	}
+	var mu sync.Mutex
+	var masters []*redis.Client
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		masters = append(masters, client)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(masters, func(i, j int) bool {
+		return masters[i].Options().Addr < masters[j].Options().Addr
+	})
+	nodes := make([]redis.Cmdable, len(masters))
+	for i, master := range masters {
+		nodes[i] = master
+	}
+	return nodes, nil
+}
+
+// cursor: node-scan cursor-scanned keys to skip
+func formatCursor(node int, cursor uint64, skip int) string {
+	return fmt.Sprintf("%d-%d-%d", node, cursor, skip)
+}
+
+func parseCursor(s string) (int, uint64, int, error) {
+	if s == "" {
+		return 0, 0, 0, nil
+	}
+	var node, skip int
+	var cursor uint64
+	if n, err := fmt.Sscanf(s, "%d-%d-%d", &node, &cursor, &skip); err != nil || n != 3 || node < 0 || skip < 0 {
+		return 0, 0, 0, ErrInvalidCursor
+	}
+	return node, cursor, skip, nil
+}
+
+// escapeGlob escapes SCAN MATCH special chars of prefix
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+// Package sqlite is a file or in-memory data access layer for tests & dev laptops
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Memory is the scheme of a db living as long as the DataAccessLayer
+const Memory = ":memory:"
+
+// names memory dbs, each DataAccessLayer owns one
+var memoryID uint64
+
+type DataAccessLayer struct {
+	dbConfig   *configs.Database
+	dbInstance *gorm.DB
+	// Used to execute client creation procedure only once.
+	once sync.Once
+}
+
+func NewDataAccessLayer(ctx context.Context, cfg *configs.Database) (*DataAccessLayer, error) {
+	dal := &DataAccessLayer{
+		dbConfig: cfg,
+		once:     sync.Once{},
+	}
+	if _, err := dal.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return dal, nil
+}
+
+// Build connection string: scheme is the db file, Memory by default
+// busy timeout: writers wait for the file lock instead of failing
+func (dal *DataAccessLayer) buildConnectionDSN() string {
+	if dal.isMemory() {
+		// named shared cache: one db for all connections of the pool, private to this DataAccessLayer
+		return fmt.Sprintf("file:dal-%d?mode=memory&cache=shared&_foreign_keys=on", atomic.AddUint64(&memoryID, 1))
+	}
+	dsn := dal.dbConfig.Scheme
+	if strings.Contains(dsn, "?") {
+		return dsn
+	}
+	return dsn + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+}
+
+func (dal *DataAccessLayer) isMemory() bool {
+	return dal.dbConfig.Scheme == "" || dal.dbConfig.Scheme == Memory
+}
+
+// Connect
+func (dal *DataAccessLayer) Connect(ctx context.Context) (*gorm.DB, error) {
+	// Perform connection creation operation only once.
+	var err error
+	dal.once.Do(func() {
+		db, e := gorm.Open(sqlite.Open(dal.buildConnectionDSN()), &gorm.Config{})
+		if e != nil {
+			err = e
+			return
+		}
+
+		// debug
+		if dal.dbConfig.Debug {
+			db = db.Debug()
+		}
+
+		sqlDB, e := db.DB()
+		if e != nil {
+			err = e
+			return
+		}
+		sqlDB.SetMaxIdleConns(dal.dbConfig.MaxIdleConns)
+		sqlDB.SetMaxOpenConns(dal.dbConfig.MaxOpenConns)
+		sqlDB.SetConnMaxLifetime(dal.dbConfig.ConnectTimeout)
+		if dal.isMemory() {
+			// memory db is dropped w its last connection: keep one open
+			sqlDB.SetConnMaxLifetime(0)
+			if dal.dbConfig.MaxIdleConns < 1 {
+				sqlDB.SetMaxIdleConns(1)
+			}
+		}
+
+		dal.dbInstance = db
+	})
+	return dal.dbInstance, err
+}
+
+func (dal *DataAccessLayer) Disconnect() error {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Ping verifies the connection to the database is still alive
+func (dal *DataAccessLayer) Ping(ctx context.Context) error {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Stats of the connection pool
+func (dal *DataAccessLayer) Stats() sql.DBStats {
+	sqlDB, err := dal.dbInstance.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+func (dal *DataAccessLayer) GetDatabase() *gorm.DB {
+	return dal.dbInstance
+}
+
+func (dal *DataAccessLayer) Transaction(ctx context.Context, trans func(tx *gorm.DB) error) error {
+	return dal.dbInstance.WithContext(ctx).Transaction(trans)
+}
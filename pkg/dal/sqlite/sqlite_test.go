@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+func TestDataAccessLayer(t *testing.T) {
+	ctx := context.Background()
+	for name, scheme := range map[string]string{
+		"memory": "",
+		"file":   filepath.Join(t.TempDir(), "test.db"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dal, err := NewDataAccessLayer(ctx, &configs.Database{Scheme: scheme, MaxOpenConns: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := dal.Disconnect(); err != nil {
+					t.Error(err)
+				}
+			}()
+			if err := dal.Ping(ctx); err != nil {
+				t.Fatalf("Ping() error = %v", err)
+			}
+			db := dal.GetDatabase()
+			if err := db.AutoMigrate(&item{}); err != nil {
+				t.Fatal(err)
+			}
+
+			errRollback := errors.New("rollback")
+			err = dal.Transaction(ctx, func(tx *gorm.DB) error {
+				// reads outside the transaction need their own connection
+				var n int64
+				if err := db.Model(&item{}).Count(&n).Error; err != nil {
+					return err
+				}
+				if err := tx.Create(&item{Name: "a"}).Error; err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Fatalf("Transaction() error = %v, want %v", err, errRollback)
+			}
+			if err := dal.Transaction(ctx, func(tx *gorm.DB) error {
+				return tx.Create(&item{Name: "b"}).Error
+			}); err != nil {
+				t.Fatal(err)
+			}
+			var items []item
+			if err := db.Find(&items).Error; err != nil || len(items) != 1 || items[0].Name != "b" {
+				t.Errorf("Find() = %v, %v, want [b]", items, err)
+			}
+			if stats := dal.Stats(); stats.MaxOpenConnections != 4 {
+				t.Errorf("Stats() = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestMemoryIsolated(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewDataAccessLayer(ctx, &configs.Database{Scheme: Memory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewDataAccessLayer(ctx, &configs.Database{Scheme: Memory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = a.Disconnect()
+		_ = b.Disconnect()
+	}()
+	if err := a.GetDatabase().AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	if b.GetDatabase().Migrator().HasTable(&item{}) {
+		t.Error("memory db shared between DataAccessLayers")
+	}
+}
@@ -2,7 +2,10 @@
 package errors
 
 import (
+	"time"
+
 	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -72,3 +75,14 @@ func NotFound(msg string, fields map[string]string) error {
 	}
 	return des.Err()
 }
+
+func ResourceExhausted(msg string, retryDelay time.Duration) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	des, err := st.WithDetails(&rpc.RetryInfo{
+		RetryDelay: types.DurationProto(retryDelay),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return des.Err()
+}
@@ -3,7 +3,9 @@ package errors
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
 
@@ -21,15 +23,25 @@ type errorBody struct {
 func CustomHTTPError(ctx context.Context, _ *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
 	const fallback = `{"error": "failed to marshal error message"}`
 
-	w.Header().Set("Content-type", marshaler.ContentType())
-	w.WriteHeader(runtime.HTTPStatusFromCode(status.Code(err)))
-
 	st := status.Convert(err)
 
 	errBd := errorBody{
 		Err: st.Message(),
 	}
 
+	w.Header().Set("Content-type", marshaler.ContentType())
+	for _, detail := range st.Details() {
+		// retry delay (seconds) of rejected request
+		if t, ok := detail.(*errdetails.RetryInfo); ok {
+			retryAfter := int64(math.Ceil(t.GetRetryDelay().AsDuration().Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+	}
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+
 	for _, detail := range st.Details() {
 		switch t := detail.(type) {
 		case *errdetails.BadRequest:
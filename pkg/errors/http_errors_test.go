@@ -0,0 +1,23 @@
+package errors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+func TestCustomHTTPErrorRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	CustomHTTPError(context.Background(), nil, &runtime.JSONPb{}, w, nil, ResourceExhausted("rate limit exceeded", 1500*time.Millisecond))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+}
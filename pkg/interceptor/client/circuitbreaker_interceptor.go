@@ -0,0 +1,305 @@
+package interceptor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// circuit breaker states, gauge values
+type CircuitState int
+
+const (
+	StateClosed CircuitState = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultFailureRatio     = 0.5
+	defaultMinRequests      = 10
+	defaultInterval         = 60 * time.Second
+	defaultCoolDown         = 10 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+var defaultFailureCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.Internal:          true,
+	codes.Unknown:           true,
+	codes.ResourceExhausted: true,
+}
+
+// breaker of a target & method
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	requests   int
+	failures   int
+	// closed: end of counting window, open: end of cool down
+	expiry time.Time
+	// half-open: probes in flight & succeeded
+	probes    int
+	successes int
+}
+
+// Circuit breaker interceptor: fail fast w codes.Unavailable while downstream keeps failing
+// closed -> open: failure ratio reached w min requests
+// open -> half-open: after cool down, probe requests are let through
+// half-open -> closed: probes succeeded, half-open -> open: a probe failed
+type CircuitBreakerClientInterceptor struct {
+	failureRatio     float64
+	minRequests      int
+	interval         time.Duration
+	coolDown         time.Duration
+	halfOpenRequests int
+	failureCodes     map[codes.Code]bool
+	now              func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+var _ ClientInterceptor = (*CircuitBreakerClientInterceptor)(nil)
+
+func NewCircuitBreakerClientInterceptor(config *configs.CircuitBreaker) *CircuitBreakerClientInterceptor {
+	labels := []string{"grpc_target", "grpc_service", "grpc_method"}
+	cb := &CircuitBreakerClientInterceptor{
+		failureRatio:     defaultFailureRatio,
+		minRequests:      defaultMinRequests,
+		interval:         defaultInterval,
+		coolDown:         defaultCoolDown,
+		halfOpenRequests: defaultHalfOpenRequests,
+		failureCodes:     defaultFailureCodes,
+		now:              time.Now,
+		circuits:         make(map[string]*circuit),
+		state: metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_client_circuit_breaker_state",
+			Help: "State of client circuit breakers: 0 closed, 1 half-open, 2 open.",
+		}, labels)).(*prometheus.GaugeVec),
+		transitions: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_circuit_breaker_transitions_total",
+			Help: "Total number of client circuit breaker state transitions.",
+		}, append(labels, "from", "to"))).(*prometheus.CounterVec),
+		rejected: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_circuit_breaker_rejected_total",
+			Help: "Total number of RPCs rejected by client circuit breakers.",
+		}, labels)).(*prometheus.CounterVec),
+	}
+	if config != nil {
+		if config.FailureRatio > 0 {
+			cb.failureRatio = config.FailureRatio
+		}
+		if config.MinRequests > 0 {
+			cb.minRequests = config.MinRequests
+		}
+		if config.CoolDown > 0 {
+			cb.coolDown = config.CoolDown
+		}
+		if config.HalfOpenRequests > 0 {
+			cb.halfOpenRequests = config.HalfOpenRequests
+		}
+		if config.Interval > 0 {
+			cb.interval = config.Interval
+		}
+		if len(config.FailureStatusCodes) > 0 {
+			cb.failureCodes = parseCodes(cb.Log(), config.FailureStatusCodes)
+		}
+	}
+	return cb
+}
+
+func (cb *CircuitBreakerClientInterceptor) Log() log.Factory {
+	return DefaultLogger.With(zap.String("interceptor-name", "circuit-breaker"))
+}
+
+func (cb *CircuitBreakerClientInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return cb.unaryClientInterceptor
+}
+
+func (cb *CircuitBreakerClientInterceptor) Stream() grpc.StreamClientInterceptor {
+	return cb.streamClientInterceptor
+}
+
+func (cb *CircuitBreakerClientInterceptor) unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	target := cc.Target()
+	generation, err := cb.allow(target, method)
+	if err != nil {
+		return err
+	}
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	cb.done(target, method, generation, err)
+	return err
+}
+
+// only stream establishment is counted
+func (cb *CircuitBreakerClientInterceptor) streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	target := cc.Target()
+	generation, err := cb.allow(target, method)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	cb.done(target, method, generation, err)
+	return stream, err
+}
+
+// State returns current state of the breaker of target & method
+func (cb *CircuitBreakerClientInterceptor) State(target, method string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[target+method]
+	if !ok {
+		return StateClosed
+	}
+	cb.refresh(c, target, method, cb.now())
+	return c.state
+}
+
+// allow checks whether request can be sent, return generation of the breaker state
+func (cb *CircuitBreakerClientInterceptor) allow(target, method string) (uint64, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	key := target + method
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[key] = c
+		cb.setState(c, target, method, StateClosed, cb.now())
+	}
+	cb.refresh(c, target, method, cb.now())
+
+	switch c.state {
+	case StateOpen:
+		cb.reject(target, method)
+		return 0, status.Errorf(codes.Unavailable, "circuit breaker is open: %s", method)
+	case StateHalfOpen:
+		if c.probes+c.successes >= cb.halfOpenRequests {
+			cb.reject(target, method)
+			return 0, status.Errorf(codes.Unavailable, "circuit breaker is half-open: %s", method)
+		}
+		c.probes++
+	}
+	c.requests++
+	return c.generation, nil
+}
+
+// done records result of a request sent in generation
+func (cb *CircuitBreakerClientInterceptor) done(target, method string, generation uint64, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuits[target+method]
+	now := cb.now()
+	cb.refresh(c, target, method, now)
+	// state changed since the request was sent
+	if c.generation != generation {
+		return
+	}
+
+	failed := err != nil && cb.failureCodes[status.Code(err)]
+	switch c.state {
+	case StateClosed:
+		if !failed {
+			return
+		}
+		c.failures++
+		if c.requests >= cb.minRequests && float64(c.failures)/float64(c.requests) >= cb.failureRatio {
+			cb.Log().Error("Circuit breaker opened",
+				zap.String("target", target),
+				zap.String("method", method),
+				zap.Int("requests", c.requests),
+				zap.Int("failures", c.failures),
+				zap.Error(err),
+			)
+			cb.setState(c, target, method, StateOpen, now)
+		}
+	case StateHalfOpen:
+		c.probes--
+		if failed {
+			cb.Log().Error("Circuit breaker probe failed", zap.String("target", target), zap.String("method", method), zap.Error(err))
+			cb.setState(c, target, method, StateOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= cb.halfOpenRequests {
+			cb.setState(c, target, method, StateClosed, now)
+		}
+	}
+}
+
+// refresh expired state: open -> half-open after cool down, reset counts of closed window
+func (cb *CircuitBreakerClientInterceptor) refresh(c *circuit, target, method string, now time.Time) {
+	if c.expiry.IsZero() || now.Before(c.expiry) {
+		return
+	}
+	switch c.state {
+	case StateOpen:
+		cb.setState(c, target, method, StateHalfOpen, now)
+	case StateClosed:
+		c.generation++
+		c.requests, c.failures = 0, 0
+		c.expiry = now.Add(cb.interval)
+	}
+}
+
+func (cb *CircuitBreakerClientInterceptor) setState(c *circuit, target, method string, state CircuitState, now time.Time) {
+	from := c.state
+	c.state = state
+	c.generation++
+	c.requests, c.failures, c.probes, c.successes = 0, 0, 0, 0
+	c.expiry = time.Time{}
+	switch state {
+	case StateClosed:
+		c.expiry = now.Add(cb.interval)
+	case StateOpen:
+		c.expiry = now.Add(cb.coolDown)
+	}
+
+	service, name := metrics.SplitMethodName(method)
+	cb.state.WithLabelValues(target, service, name).Set(float64(state))
+	if from == state {
+		return
+	}
+	cb.transitions.WithLabelValues(target, service, name, from.String(), state.String()).Inc()
+	cb.Log().Info("Circuit breaker state changed",
+		zap.String("target", target),
+		zap.String("method", method),
+		zap.Stringer("from", from),
+		zap.Stringer("to", state),
+	)
+}
+
+func (cb *CircuitBreakerClientInterceptor) reject(target, method string) {
+	service, name := metrics.SplitMethodName(method)
+	cb.rejected.WithLabelValues(target, service, name).Inc()
+}
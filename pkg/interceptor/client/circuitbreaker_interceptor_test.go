@@ -0,0 +1,154 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreakerClientInterceptor(t *testing.T) {
+	cc, err := grpc.Dial("passthrough:///user", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	now := time.Now()
+	cb := NewCircuitBreakerClientInterceptor(&configs.CircuitBreaker{
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		CoolDown:         10 * time.Second,
+		HalfOpenRequests: 2,
+	})
+	cb.now = func() time.Time { return now }
+
+	var calls int
+	call := func(code codes.Code) error {
+		return cb.Unary()(context.Background(), testMethod, nil, nil, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			if code == codes.OK {
+				return nil
+			}
+			return status.Error(code, "failed")
+		})
+	}
+	assertState := func(want CircuitState) {
+		t.Helper()
+		if got := cb.State(cc.Target(), testMethod); got != want {
+			t.Errorf("State() = %v, want %v", got, want)
+		}
+	}
+
+	// client errors are not failures
+	for i := 0; i < 4; i++ {
+		_ = call(codes.NotFound)
+	}
+	assertState(StateClosed)
+
+	// 50% failures over min requests
+	_ = call(codes.Unavailable)
+	_ = call(codes.Unavailable)
+	_ = call(codes.Unavailable)
+	assertState(StateClosed)
+	_ = call(codes.DeadlineExceeded)
+	assertState(StateOpen)
+
+	// fail fast
+	calls = 0
+	if err := call(codes.OK); status.Code(err) != codes.Unavailable {
+		t.Errorf("call() while open code = %v, want %v", status.Code(err), codes.Unavailable)
+	}
+	if calls != 0 {
+		t.Errorf("calls while open = %d, want 0", calls)
+	}
+
+	// half-open after cool down, a failed probe opens again
+	now = now.Add(10 * time.Second)
+	assertState(StateHalfOpen)
+	_ = call(codes.Unavailable)
+	assertState(StateOpen)
+
+	// successful probes close
+	now = now.Add(10 * time.Second)
+	if err := call(codes.OK); err != nil {
+		t.Errorf("probe error = %v", err)
+	}
+	assertState(StateHalfOpen)
+	if err := call(codes.OK); err != nil {
+		t.Errorf("probe error = %v", err)
+	}
+	assertState(StateClosed)
+}
+
+func TestCircuitBreakerClientInterceptor_DefaultInterval(t *testing.T) {
+	cc, err := grpc.Dial("passthrough:///user", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	now := time.Now()
+	cb := NewCircuitBreakerClientInterceptor(&configs.CircuitBreaker{MinRequests: 4})
+	cb.now = func() time.Time { return now }
+	fail := func() {
+		generation, err := cb.allow(cc.Target(), testMethod)
+		if err != nil {
+			t.Fatalf("allow() error = %v", err)
+		}
+		cb.done(cc.Target(), testMethod, generation, status.Error(codes.Unavailable, ""))
+	}
+
+	// failures of an elapsed window are forgotten
+	for i := 0; i < 3; i++ {
+		fail()
+	}
+	now = now.Add(defaultInterval)
+	fail()
+	if got := cb.State(cc.Target(), testMethod); got != StateClosed {
+		t.Errorf("State() = %v, want %v", got, StateClosed)
+	}
+	for i := 0; i < 3; i++ {
+		fail()
+	}
+	if got := cb.State(cc.Target(), testMethod); got != StateOpen {
+		t.Errorf("State() = %v, want %v", got, StateOpen)
+	}
+}
+
+func TestCircuitBreakerClientInterceptor_HalfOpenLimit(t *testing.T) {
+	cc, err := grpc.Dial("passthrough:///user", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	now := time.Now()
+	cb := NewCircuitBreakerClientInterceptor(&configs.CircuitBreaker{MinRequests: 1, CoolDown: time.Second})
+	cb.now = func() time.Time { return now }
+
+	generation, err := cb.allow(cc.Target(), testMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.done(cc.Target(), testMethod, generation, status.Error(codes.Unavailable, ""))
+	now = now.Add(time.Second)
+
+	// single probe in flight, concurrent requests rejected
+	probe, err := cb.allow(cc.Target(), testMethod)
+	if err != nil {
+		t.Fatalf("allow() probe error = %v", err)
+	}
+	if _, err := cb.allow(cc.Target(), testMethod); status.Code(err) != codes.Unavailable {
+		t.Errorf("allow() during probe code = %v, want %v", status.Code(err), codes.Unavailable)
+	}
+	cb.done(cc.Target(), testMethod, probe, nil)
+	if got := cb.State(cc.Target(), testMethod); got != StateClosed {
+		t.Errorf("State() = %v, want %v", got, StateClosed)
+	}
+}
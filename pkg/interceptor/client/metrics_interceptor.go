@@ -0,0 +1,158 @@
+package interceptor
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics interceptor: RED metrics (rate, errors, duration) per rpc
+type MetricsClientInterceptor struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	handling    *prometheus.HistogramVec
+	inFlight    *prometheus.GaugeVec
+	msgReceived *prometheus.CounterVec
+	msgSent     *prometheus.CounterVec
+}
+
+var _ ClientInterceptor = (*MetricsClientInterceptor)(nil)
+
+func NewMetricsClientInterceptor() *MetricsClientInterceptor {
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	return &MetricsClientInterceptor{
+		started: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_started_total",
+			Help: "Total number of RPCs started on the client.",
+		}, labels)).(*prometheus.CounterVec),
+		handled: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_handled_total",
+			Help: "Total number of RPCs completed by the client, regardless of success or failure.",
+		}, append(labels, "grpc_code"))).(*prometheus.CounterVec),
+		handling: metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_client_handling_seconds",
+			Help:    "Histogram of response latency (seconds) of the gRPC until it is finished by the application.",
+			Buckets: prometheus.DefBuckets,
+		}, labels)).(*prometheus.HistogramVec),
+		inFlight: metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_client_in_flight",
+			Help: "Number of RPCs currently in flight on the client.",
+		}, labels)).(*prometheus.GaugeVec),
+		msgReceived: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_msg_received_total",
+			Help: "Total number of RPC stream messages received by the client.",
+		}, labels)).(*prometheus.CounterVec),
+		msgSent: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_msg_sent_total",
+			Help: "Total number of gRPC stream messages sent by the client.",
+		}, labels)).(*prometheus.CounterVec),
+	}
+}
+
+func (m *MetricsClientInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return m.unaryClientInterceptor
+}
+
+func (m *MetricsClientInterceptor) Stream() grpc.StreamClientInterceptor {
+	return m.streamClientInterceptor
+}
+
+func (m *MetricsClientInterceptor) unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	service, name := metrics.SplitMethodName(method)
+	done := m.begin(metrics.Unary, service, name)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	done(err)
+	return err
+}
+
+func (m *MetricsClientInterceptor) streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	service, name := metrics.SplitMethodName(method)
+	grpcType := metrics.StreamType(desc.ClientStreams, desc.ServerStreams)
+	done := m.begin(grpcType, service, name)
+	clientStream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	s := &monitoredClientStream{
+		ClientStream:  clientStream,
+		serverStreams: desc.ServerStreams,
+		done:          done,
+		finished:      make(chan struct{}),
+		received:      m.msgReceived.WithLabelValues(grpcType, service, name),
+		sent:          m.msgSent.WithLabelValues(grpcType, service, name),
+	}
+	// abandoned stream: never read to EOF, completed once its ctx is done
+	go func() {
+		select {
+		case <-clientStream.Context().Done():
+			s.finish(status.FromContextError(clientStream.Context().Err()).Err())
+		case <-s.finished:
+		}
+	}()
+	return s, nil
+}
+
+// begin records a started rpc, the returned func records its completion
+func (m *MetricsClientInterceptor) begin(grpcType, service, method string) func(err error) {
+	start := time.Now()
+	m.started.WithLabelValues(grpcType, service, method).Inc()
+	inFlight := m.inFlight.WithLabelValues(grpcType, service, method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		m.handled.WithLabelValues(grpcType, service, method, status.Code(err).String()).Inc()
+		m.handling.WithLabelValues(grpcType, service, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// count stream messages & record completion when the stream ends
+type monitoredClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          func(err error)
+	finished      chan struct{}
+	received      prometheus.Counter
+	sent          prometheus.Counter
+}
+
+func (s *monitoredClientStream) SendMsg(msg interface{}) error {
+	err := s.ClientStream.SendMsg(msg)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(msg interface{}) error {
+	err := s.ClientStream.RecvMsg(msg)
+	switch {
+	case err == nil:
+		s.received.Inc()
+		// client streaming: single response ends the rpc
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+	case err == io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+// finish records completion once, by the first of RecvMsg end or ctx done
+func (s *monitoredClientStream) finish(err error) {
+	s.once.Do(func() {
+		s.done(err)
+		close(s.finished)
+	})
+}
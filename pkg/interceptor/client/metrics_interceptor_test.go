@@ -0,0 +1,104 @@
+package interceptor
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClientStream ends w io.EOF after msgs responses
+type fakeClientStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	msgs int
+}
+
+func (s *fakeClientStream) Context() context.Context { return s.ctx }
+
+func (s *fakeClientStream) RecvMsg(msg interface{}) error {
+	if s.msgs == 0 {
+		return io.EOF
+	}
+	s.msgs--
+	return nil
+}
+
+func TestMetricsClientInterceptor_Unary(t *testing.T) {
+	m := NewMetricsClientInterceptor()
+	method := "/metrics.Test/Unary"
+	invoke := func(err error) error {
+		return m.Unary()(context.Background(), method, nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if got := testutil.ToFloat64(m.inFlight.WithLabelValues("unary", "metrics.Test", "Unary")); got != 1 {
+				t.Errorf("in flight = %v, want 1", got)
+			}
+			return err
+		})
+	}
+	_ = invoke(nil)
+	_ = invoke(status.Error(codes.NotFound, "not found"))
+
+	if got := testutil.ToFloat64(m.started.WithLabelValues("unary", "metrics.Test", "Unary")); got != 2 {
+		t.Errorf("started = %v, want 2", got)
+	}
+	for _, code := range []codes.Code{codes.OK, codes.NotFound} {
+		if got := testutil.ToFloat64(m.handled.WithLabelValues("unary", "metrics.Test", "Unary", code.String())); got != 1 {
+			t.Errorf("handled %v = %v, want 1", code, got)
+		}
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("unary", "metrics.Test", "Unary")); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+}
+
+func TestMetricsClientInterceptor_Stream(t *testing.T) {
+	m := NewMetricsClientInterceptor()
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	open := func(ctx context.Context, method string) grpc.ClientStream {
+		cs, err := m.Stream()(ctx, desc, nil, method, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{ctx: ctx, msgs: 2}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+
+	// read to EOF
+	cs := open(context.Background(), "/metrics.Test/Read")
+	for cs.RecvMsg(nil) == nil {
+	}
+	if got := testutil.ToFloat64(m.msgReceived.WithLabelValues("server_stream", "metrics.Test", "Read")); got != 2 {
+		t.Errorf("received = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("server_stream", "metrics.Test", "Read", "OK")); got != 1 {
+		t.Errorf("handled = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("server_stream", "metrics.Test", "Read")); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+
+	// abandoned: completed on ctx done
+	ctx, cancel := context.WithCancel(context.Background())
+	open(ctx, "/metrics.Test/Abandon")
+	inFlight := m.inFlight.WithLabelValues("server_stream", "metrics.Test", "Abandon")
+	if got := testutil.ToFloat64(inFlight); got != 1 {
+		t.Errorf("in flight = %v, want 1", got)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(inFlight) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(inFlight); got != 0 {
+		t.Errorf("in flight after cancel = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("server_stream", "metrics.Test", "Abandon", "Canceled")); got != 1 {
+		t.Errorf("handled canceled = %v, want 1", got)
+	}
+}
@@ -0,0 +1,380 @@
+package interceptor
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// attempt number sent to server on retried & hedged calls
+const RetryAttemptHeader = "x-retry-attempt"
+
+const (
+	defaultInitialBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff        = 5 * time.Second
+	defaultBackoffMultiplier = 2.0
+)
+
+// per method call policy
+type callPolicy struct {
+	timeout time.Duration
+	retry   *retryPolicy
+	hedging *hedgingPolicy
+}
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	retryable      map[codes.Code]bool
+}
+
+type hedgingPolicy struct {
+	maxAttempts int
+	delay       time.Duration
+	nonFatal    map[codes.Code]bool
+}
+
+// Retry interceptor: default deadline, retries w exponential backoff or hedging per method
+// NOTE: streams are passed through, only unary calls are retried
+type RetryClientInterceptor struct {
+	methods  map[string]*callPolicy
+	services map[string]*callPolicy
+	fallback *callPolicy
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ ClientInterceptor = (*RetryClientInterceptor)(nil)
+
+func NewRetryClientInterceptor(methods []*configs.MethodConfig) *RetryClientInterceptor {
+	r := &RetryClientInterceptor{
+		methods:  make(map[string]*callPolicy),
+		services: make(map[string]*callPolicy),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, m := range methods {
+		if m == nil {
+			continue
+		}
+		policy := r.newCallPolicy(m)
+		for _, name := range m.Name {
+			switch {
+			case name == "*":
+				r.fallback = policy
+			case strings.HasSuffix(name, "/"):
+				r.services[name] = policy
+			default:
+				r.methods[name] = policy
+			}
+		}
+	}
+	return r
+}
+
+func (r *RetryClientInterceptor) Log() log.Factory {
+	return DefaultLogger.With(zap.String("interceptor-name", "retry"))
+}
+
+func (r *RetryClientInterceptor) newCallPolicy(m *configs.MethodConfig) *callPolicy {
+	policy := &callPolicy{timeout: m.Timeout}
+	if m.Retry != nil && m.Retry.MaxAttempts > 1 {
+		policy.retry = &retryPolicy{
+			maxAttempts:    m.Retry.MaxAttempts,
+			initialBackoff: m.Retry.InitialBackoff,
+			maxBackoff:     m.Retry.MaxBackoff,
+			multiplier:     m.Retry.BackoffMultiplier,
+			jitter:         m.Retry.Jitter,
+			retryable:      parseCodes(r.Log(), m.Retry.RetryableStatusCodes),
+		}
+		if policy.retry.initialBackoff <= 0 {
+			policy.retry.initialBackoff = defaultInitialBackoff
+		}
+		if policy.retry.maxBackoff <= 0 {
+			policy.retry.maxBackoff = defaultMaxBackoff
+		}
+		if policy.retry.multiplier < 1 {
+			policy.retry.multiplier = defaultBackoffMultiplier
+		}
+		// retry unavailable server by default
+		if len(policy.retry.retryable) == 0 {
+			policy.retry.retryable = map[codes.Code]bool{codes.Unavailable: true}
+		}
+	}
+	if m.Hedging != nil && m.Hedging.MaxAttempts > 1 {
+		policy.hedging = &hedgingPolicy{
+			maxAttempts: m.Hedging.MaxAttempts,
+			delay:       m.Hedging.HedgingDelay,
+			nonFatal:    parseCodes(r.Log(), m.Hedging.NonFatalStatusCodes),
+		}
+		if policy.retry != nil {
+			r.Log().Error("Retry & hedging policies are exclusive, use hedging", zap.Strings("methods", m.Name))
+			policy.retry = nil
+		}
+	}
+	return policy
+}
+
+// parse grpc code names, eg. UNAVAILABLE | unavailable
+func parseCodes(logger log.Factory, names []string) map[codes.Code]bool {
+	m := make(map[codes.Code]bool, len(names))
+	for _, name := range names {
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+			logger.Error("Invalid status code", zap.String("code", name), zap.Error(err))
+			continue
+		}
+		m[c] = true
+	}
+	return m
+}
+
+// policy of full method name: method > service > default
+func (r *RetryClientInterceptor) policy(method string) *callPolicy {
+	if p, ok := r.methods[method]; ok {
+		return p
+	}
+	if i := strings.LastIndex(method, "/"); i >= 0 {
+		if p, ok := r.services[method[:i+1]]; ok {
+			return p
+		}
+	}
+	return r.fallback
+}
+
+func (r *RetryClientInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return r.unaryClientInterceptor
+}
+
+func (r *RetryClientInterceptor) Stream() grpc.StreamClientInterceptor {
+	return r.streamClientInterceptor
+}
+
+func (r *RetryClientInterceptor) unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	policy := r.policy(method)
+	if policy == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	// default deadline
+	if _, ok := ctx.Deadline(); !ok && policy.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.timeout)
+		defer cancel()
+	}
+
+	switch {
+	case policy.hedging != nil:
+		return r.hedge(ctx, policy.hedging, method, req, reply, cc, invoker, opts...)
+	case policy.retry != nil:
+		return r.retry(ctx, policy.retry, method, req, reply, cc, invoker, opts...)
+	default:
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func (r *RetryClientInterceptor) streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// each attempt is a separate call (client span) w attempt number in metadata
+func attemptContext(ctx context.Context, attempt int) context.Context {
+	if attempt <= 1 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, RetryAttemptHeader, strconv.Itoa(attempt))
+}
+
+func (r *RetryClientInterceptor) retry(ctx context.Context, policy *retryPolicy, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	for attempt := 1; ; attempt++ {
+		err := invoker(attemptContext(ctx, attempt), method, req, reply, cc, opts...)
+		if err == nil {
+			if attempt > 1 {
+				r.Log().For(ctx).Info("Retry succeeded", zap.String("method", method), zap.Int("attempt", attempt))
+			}
+			return nil
+		}
+		code := status.Code(err)
+		if attempt >= policy.maxAttempts || !policy.retryable[code] || ctx.Err() != nil {
+			if attempt > 1 {
+				r.Log().For(ctx).Error("Retry failed", zap.String("method", method), zap.Int("attempt", attempt), zap.Error(err))
+			}
+			return err
+		}
+
+		backoff := r.backoff(policy, attempt, err)
+		r.Log().For(ctx).Info("Retrying",
+			zap.String("method", method),
+			zap.Int("attempt", attempt),
+			zap.Stringer("code", code),
+			zap.Duration("backoff", backoff),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// exponential backoff w jitter, at least the retry delay sent by server (eg. rate limited)
+func (r *RetryClientInterceptor) backoff(policy *retryPolicy, attempt int, err error) time.Duration {
+	backoff := float64(policy.initialBackoff) * math.Pow(policy.multiplier, float64(attempt-1))
+	if backoff > float64(policy.maxBackoff) {
+		backoff = float64(policy.maxBackoff)
+	}
+	if policy.jitter > 0 {
+		r.mu.Lock()
+		backoff *= 1 + policy.jitter*(2*r.rand.Float64()-1)
+		r.mu.Unlock()
+	}
+	d := time.Duration(backoff)
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			if delay := info.GetRetryDelay().AsDuration(); delay > d {
+				d = delay
+			}
+		}
+	}
+	return d
+}
+
+type hedgeResult struct {
+	attempt int
+	reply   interface{}
+	err     error
+	// copy header, trailer & peer of the attempt into caller's call options
+	commit func()
+}
+
+// attemptCallOptions replaces header, trailer & peer call options (written concurrently by attempts)
+// w per attempt ones, commit copies them back into caller's options
+func attemptCallOptions(opts []grpc.CallOption) ([]grpc.CallOption, func()) {
+	attemptOpts := make([]grpc.CallOption, 0, len(opts))
+	var commits []func()
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			md := new(metadata.MD)
+			attemptOpts = append(attemptOpts, grpc.Header(md))
+			commits = append(commits, func() { *o.HeaderAddr = *md })
+		case grpc.TrailerCallOption:
+			md := new(metadata.MD)
+			attemptOpts = append(attemptOpts, grpc.Trailer(md))
+			commits = append(commits, func() { *o.TrailerAddr = *md })
+		case grpc.PeerCallOption:
+			p := new(peer.Peer)
+			attemptOpts = append(attemptOpts, grpc.Peer(p))
+			commits = append(commits, func() { *o.PeerAddr = *p })
+		default:
+			attemptOpts = append(attemptOpts, opt)
+		}
+	}
+	return attemptOpts, func() {
+		for _, commit := range commits {
+			commit()
+		}
+	}
+}
+
+// send up to maxAttempts calls delayed by policy.delay, return the first success or fatal error
+func (r *RetryClientInterceptor) hedge(ctx context.Context, policy *hedgingPolicy, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	// cancel pending attempts once done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, policy.maxAttempts)
+	send := func(attempt int) {
+		// each attempt decodes into its own reply
+		rsp := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+		attemptOpts, commit := attemptCallOptions(opts)
+		err := invoker(attemptContext(ctx, attempt), method, req, rsp, cc, attemptOpts...)
+		results <- hedgeResult{attempt: attempt, reply: rsp, err: err, commit: commit}
+	}
+
+	sent, pending := 1, 1
+	go send(sent)
+	timer := time.NewTimer(policy.delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if sent < policy.maxAttempts {
+				sent++
+				pending++
+				r.Log().For(ctx).Info("Hedging", zap.String("method", method), zap.Int("attempt", sent))
+				go send(sent)
+				timer.Reset(policy.delay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.attempt > 1 {
+					r.Log().For(ctx).Info("Hedged attempt succeeded", zap.String("method", method), zap.Int("attempt", res.attempt))
+				}
+				copyReply(reply, res.reply)
+				res.commit()
+				return nil
+			}
+			lastErr = res.err
+			res.commit()
+			if !policy.nonFatal[status.Code(res.err)] {
+				return res.err
+			}
+			// non-fatal: send next attempt right away
+			if sent < policy.maxAttempts && ctx.Err() == nil {
+				sent++
+				pending++
+				r.Log().For(ctx).Info("Hedging", zap.String("method", method), zap.Int("attempt", sent), zap.Error(res.err))
+				go send(sent)
+				resetTimer(timer, policy.delay)
+			}
+		}
+	}
+	r.Log().For(ctx).Error("Hedging failed", zap.String("method", method), zap.Int("attempts", sent), zap.Error(lastErr))
+	return lastErr
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// copyReply copies the winning hedged reply into the caller's, messages are merged not copied by value (internal state & locks)
+func copyReply(dst, src interface{}) {
+	if d, ok := dst.(proto.Message); ok {
+		d.Reset()
+		proto.Merge(d, src.(proto.Message))
+		return
+	}
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+}
@@ -0,0 +1,209 @@
+package interceptor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/grpc.health.v1.Health/Check"
+
+// invoker failing w codes until succeeded
+func failingInvoker(calls *int32, fails ...codes.Code) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		n := atomic.AddInt32(calls, 1)
+		if int(n) <= len(fails) {
+			return status.Error(fails[n-1], "failed")
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+}
+
+func TestRetryClientInterceptor_Retry(t *testing.T) {
+	i := NewRetryClientInterceptor([]*configs.MethodConfig{
+		{
+			Name: []string{"/grpc.health.v1.Health/"},
+			Retry: &configs.RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       time.Millisecond,
+				Jitter:               0.2,
+				RetryableStatusCodes: []string{"UNAVAILABLE", "resource_exhausted"},
+			},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		fails     []codes.Code
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{name: "success", wantCode: codes.OK, wantCalls: 1},
+		{name: "retried", fails: []codes.Code{codes.Unavailable, codes.ResourceExhausted}, wantCode: codes.OK, wantCalls: 3},
+		{name: "max attempts", fails: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}, wantCode: codes.Unavailable, wantCalls: 3},
+		{name: "not retryable", fails: []codes.Code{codes.InvalidArgument}, wantCode: codes.InvalidArgument, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			reply := &healthpb.HealthCheckResponse{}
+			err := i.Unary()(context.Background(), testMethod, &healthpb.HealthCheckRequest{}, reply, nil, failingInvoker(&calls, tt.fails...))
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("Unary() code = %v, want %v", status.Code(err), tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Unary() calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if err == nil && reply.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("Unary() reply = %v, want SERVING", reply.GetStatus())
+			}
+		})
+	}
+}
+
+func TestRetryClientInterceptor_AttemptHeader(t *testing.T) {
+	i := NewRetryClientInterceptor([]*configs.MethodConfig{
+		{Name: []string{testMethod}, Retry: &configs.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}},
+	})
+	var attempts []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		attempts = append(attempts, md.Get(RetryAttemptHeader)...)
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+	_ = i.Unary()(context.Background(), testMethod, nil, &healthpb.HealthCheckResponse{}, nil, invoker)
+	if len(attempts) != 1 || attempts[0] != "2" {
+		t.Errorf("%s = %v, want [2]", RetryAttemptHeader, attempts)
+	}
+}
+
+func TestRetryClientInterceptor_Timeout(t *testing.T) {
+	i := NewRetryClientInterceptor([]*configs.MethodConfig{
+		{Name: []string{"*"}, Timeout: time.Second},
+		{Name: []string{"/other.Service/Method"}, Timeout: time.Hour},
+	})
+	deadline := func(ctx context.Context) time.Duration {
+		var got time.Duration
+		_ = i.Unary()(ctx, testMethod, nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if d, ok := ctx.Deadline(); ok {
+				got = time.Until(d)
+			}
+			return nil
+		})
+		return got
+	}
+
+	// default deadline
+	if got := deadline(context.Background()); got <= 0 || got > time.Second {
+		t.Errorf("deadline = %v, want (0, 1s]", got)
+	}
+	// caller deadline kept
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if got := deadline(ctx); got <= time.Second {
+		t.Errorf("deadline = %v, want caller deadline ~1m", got)
+	}
+}
+
+func TestRetryClientInterceptor_Hedging(t *testing.T) {
+	i := NewRetryClientInterceptor([]*configs.MethodConfig{
+		{
+			Name: []string{testMethod},
+			Hedging: &configs.HedgingPolicy{
+				MaxAttempts:         3,
+				HedgingDelay:        10 * time.Millisecond,
+				NonFatalStatusCodes: []string{"UNAVAILABLE"},
+			},
+		},
+	})
+
+	t.Run("slow first attempt", func(t *testing.T) {
+		var calls int32
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+			for _, opt := range opts {
+				if h, ok := opt.(grpc.HeaderCallOption); ok {
+					*h.HeaderAddr = metadata.Pairs("attempt", "2")
+				}
+			}
+			return nil
+		}
+		reply := &healthpb.HealthCheckResponse{}
+		var header metadata.MD
+		err := i.Unary()(context.Background(), testMethod, nil, reply, nil, invoker, grpc.Header(&header))
+		if err != nil {
+			t.Fatalf("Unary() error = %v", err)
+		}
+		if reply.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Unary() reply = %v, want SERVING", reply.GetStatus())
+		}
+		if got := header.Get("attempt"); len(got) != 1 || got[0] != "2" {
+			t.Errorf("Unary() header attempt = %v, want [2]", got)
+		}
+	})
+
+	t.Run("fatal error", func(t *testing.T) {
+		var calls int32
+		err := i.Unary()(context.Background(), testMethod, nil, &healthpb.HealthCheckResponse{}, nil, failingInvoker(&calls, codes.NotFound))
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Unary() code = %v, want %v", status.Code(err), codes.NotFound)
+		}
+		if calls != 1 {
+			t.Errorf("Unary() calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("non fatal errors", func(t *testing.T) {
+		var calls int32
+		err := i.Unary()(context.Background(), testMethod, nil, &healthpb.HealthCheckResponse{}, nil, failingInvoker(&calls, codes.Unavailable, codes.Unavailable, codes.Unavailable))
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Unary() code = %v, want %v", status.Code(err), codes.Unavailable)
+		}
+		if calls != 3 {
+			t.Errorf("Unary() calls = %d, want 3", calls)
+		}
+	})
+}
+
+func TestRetryClientInterceptor_Backoff(t *testing.T) {
+	i := NewRetryClientInterceptor(nil)
+	policy := &retryPolicy{
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+		multiplier:     2,
+		jitter:         0.1,
+	}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 90 * time.Millisecond, max: 110 * time.Millisecond},
+		{attempt: 3, min: 360 * time.Millisecond, max: 440 * time.Millisecond},
+		{attempt: 10, min: 900 * time.Millisecond, max: 1100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := i.backoff(policy, tt.attempt, status.Error(codes.Unavailable, "")); got < tt.min || got > tt.max {
+			t.Errorf("backoff(%d) = %v, want [%v, %v]", tt.attempt, got, tt.min, tt.max)
+		}
+	}
+
+	// retry delay sent by server
+	if got := i.backoff(policy, 1, errors.ResourceExhausted("rate limited", 2*time.Second)); got != 2*time.Second {
+		t.Errorf("backoff() = %v, want server retry delay %v", got, 2*time.Second)
+	}
+}
@@ -21,3 +21,18 @@ type ServerInterceptor interface {
 	Stream() grpc.StreamServerInterceptor
 	StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error)
 }
+
+// server stream w overridden context (eg. values set by interceptors)
+type wrappedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedServerStream) Context() context.Context {
+	return w.ctx
+}
+
+// WrapServerStream returns server stream w ctx passed to the next handlers
+func WrapServerStream(ctx context.Context, ss grpc.ServerStream) grpc.ServerStream {
+	return &wrappedServerStream{ServerStream: ss, ctx: ctx}
+}
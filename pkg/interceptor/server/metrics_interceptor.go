@@ -0,0 +1,122 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics interceptor: RED metrics (rate, errors, duration) per rpc
+type MetricsServerInterceptor struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	handling    *prometheus.HistogramVec
+	inFlight    *prometheus.GaugeVec
+	msgReceived *prometheus.CounterVec
+	msgSent     *prometheus.CounterVec
+}
+
+var _ ServerInterceptor = (*MetricsServerInterceptor)(nil)
+
+func NewMetricsServerInterceptor() *MetricsServerInterceptor {
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	return &MetricsServerInterceptor{
+		started: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		}, labels)).(*prometheus.CounterVec),
+		handled: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, append(labels, "grpc_code"))).(*prometheus.CounterVec),
+		handling: metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		}, labels)).(*prometheus.HistogramVec),
+		inFlight: metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "Number of RPCs currently handled by the server.",
+		}, labels)).(*prometheus.GaugeVec),
+		msgReceived: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Total number of RPC stream messages received on the server.",
+		}, labels)).(*prometheus.CounterVec),
+		msgSent: metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Total number of gRPC stream messages sent by the server.",
+		}, labels)).(*prometheus.CounterVec),
+	}
+}
+
+func (m *MetricsServerInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return m.UnaryInterceptor
+}
+
+func (m *MetricsServerInterceptor) Stream() grpc.StreamServerInterceptor {
+	return m.StreamInterceptor
+}
+
+// unary request to grpc server
+func (m *MetricsServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	service, method := metrics.SplitMethodName(info.FullMethod)
+	done := m.begin(metrics.Unary, service, method)
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// stream request interceptor
+func (m *MetricsServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	service, method := metrics.SplitMethodName(info.FullMethod)
+	grpcType := metrics.StreamType(info.IsClientStream, info.IsServerStream)
+	done := m.begin(grpcType, service, method)
+	err := handler(srv, &monitoredServerStream{
+		ServerStream: ss,
+		received:     m.msgReceived.WithLabelValues(grpcType, service, method),
+		sent:         m.msgSent.WithLabelValues(grpcType, service, method),
+	})
+	done(err)
+	return err
+}
+
+// begin records a started rpc, the returned func records its completion
+func (m *MetricsServerInterceptor) begin(grpcType, service, method string) func(err error) {
+	start := time.Now()
+	m.started.WithLabelValues(grpcType, service, method).Inc()
+	inFlight := m.inFlight.WithLabelValues(grpcType, service, method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		m.handled.WithLabelValues(grpcType, service, method, status.Code(err).String()).Inc()
+		m.handling.WithLabelValues(grpcType, service, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// count stream messages
+type monitoredServerStream struct {
+	grpc.ServerStream
+	received prometheus.Counter
+	sent     prometheus.Counter
+}
+
+func (s *monitoredServerStream) SendMsg(msg interface{}) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *monitoredServerStream) RecvMsg(msg interface{}) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
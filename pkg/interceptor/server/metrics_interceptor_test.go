@@ -0,0 +1,61 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServerStream struct {
+	grpc.ServerStream
+}
+
+func (fakeServerStream) SendMsg(msg interface{}) error { return nil }
+func (fakeServerStream) RecvMsg(msg interface{}) error { return nil }
+
+func TestMetricsServerInterceptor(t *testing.T) {
+	m := NewMetricsServerInterceptor()
+	// registered once: a second interceptor shares the collectors
+	if NewMetricsServerInterceptor().started != m.started {
+		t.Error("NewMetricsServerInterceptor() registered collectors twice")
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/metrics.Test/Unary"}
+	for _, err := range []error{nil, status.Error(codes.InvalidArgument, "invalid")} {
+		_, _ = m.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if got := testutil.ToFloat64(m.inFlight.WithLabelValues("unary", "metrics.Test", "Unary")); got != 1 {
+				t.Errorf("in flight = %v, want 1", got)
+			}
+			return nil, err
+		})
+	}
+	if got := testutil.ToFloat64(m.started.WithLabelValues("unary", "metrics.Test", "Unary")); got != 2 {
+		t.Errorf("started = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.handled.WithLabelValues("unary", "metrics.Test", "Unary", "InvalidArgument")); got != 1 {
+		t.Errorf("handled = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("unary", "metrics.Test", "Unary")); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/metrics.Test/Bidi", IsClientStream: true, IsServerStream: true}
+	_ = m.StreamInterceptor(nil, fakeServerStream{}, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		_ = stream.RecvMsg(nil)
+		_ = stream.SendMsg(nil)
+		return stream.SendMsg(nil)
+	})
+	if got := testutil.ToFloat64(m.msgReceived.WithLabelValues("bidi_stream", "metrics.Test", "Bidi")); got != 1 {
+		t.Errorf("received = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.msgSent.WithLabelValues("bidi_stream", "metrics.Test", "Bidi")); got != 2 {
+		t.Errorf("sent = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(m.handling); got == 0 {
+		t.Error("handling not observed")
+	}
+}
@@ -0,0 +1,134 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/errors"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/ratelimit"
+	"github.com/1412335/grpc-rest-microservice/pkg/utils"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// rate limit bucket keys
+const (
+	RateLimitByUser = "user"
+	RateLimitByPeer = "peer"
+	RateLimitGlobal = "global"
+)
+
+// Rate limit interceptor: token bucket per method & user | peer | global
+type RateLimitServerInterceptor struct {
+	limiter ratelimit.Limiter
+	limits  map[string]*configs.RateLimit
+}
+
+var _ ServerInterceptor = (*RateLimitServerInterceptor)(nil)
+
+func NewRateLimitServerInterceptor(limiter ratelimit.Limiter, limits []*configs.RateLimit) *RateLimitServerInterceptor {
+	r := &RateLimitServerInterceptor{
+		limiter: limiter,
+		limits:  make(map[string]*configs.RateLimit, len(limits)),
+	}
+	for _, l := range limits {
+		if l == nil || l.Rate <= 0 || l.Burst <= 0 {
+			r.Log().Bg().Error("Invalid rate limit", zap.Any("limit", l))
+			continue
+		}
+		r.limits[l.Method] = l
+	}
+	return r
+}
+
+func (r *RateLimitServerInterceptor) Log() log.Factory {
+	return DefaultLogger.With(zap.String("interceptor-name", "ratelimit"))
+}
+
+func (r *RateLimitServerInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return r.UnaryInterceptor
+}
+
+func (r *RateLimitServerInterceptor) Stream() grpc.StreamServerInterceptor {
+	return r.StreamInterceptor
+}
+
+// unary request to grpc server
+func (r *RateLimitServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := r.limit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// stream request interceptor: limit opening streams
+func (r *RateLimitServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := r.limit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (r *RateLimitServerInterceptor) limit(ctx context.Context, method string) error {
+	l, ok := r.limits[method]
+	if !ok {
+		return nil
+	}
+	key := bucketKey(ctx, l)
+	allowed, wait, err := r.limiter.Allow(ctx, key, l.Rate, l.Burst)
+	if err != nil {
+		// fail open when limiter backend is unavailable
+		r.Log().For(ctx).Error("Rate limiter failed", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	if !allowed {
+		r.Log().For(ctx).Info("Rate limit exceeded", zap.String("key", key), zap.Duration("retry", wait))
+		return errors.ResourceExhausted("rate limit exceeded", wait)
+	}
+	return nil
+}
+
+// bucketKey returns bucket of method by user id, client ip or global
+// user falls back to peer for unauthenticated requests
+func bucketKey(ctx context.Context, l *configs.RateLimit) string {
+	switch l.Key {
+	case RateLimitGlobal:
+		return l.Method
+	case RateLimitByUser:
+		if userID, ok := utils.GetContextValue(ctx, utils.UserIDContextKey); ok && userID != "" {
+			return l.Method + ":user:" + userID
+		}
+	}
+	return l.Method + ":peer:" + peerIP(ctx)
+}
+
+// peerIP returns client ip, requests proxied by the local gateway use x-forwarded-for
+// only the rightmost entry is the peer seen by the gateway, the rest are sent by the client
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			// header of the client may be passed through as is before the gateway value
+			if xff := md.Get("x-forwarded-for"); len(xff) > 0 {
+				entries := strings.Split(xff[len(xff)-1], ",")
+				if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+					return ip
+				}
+			}
+		}
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/ratelimit"
+	"github.com/1412335/grpc-rest-microservice/pkg/utils"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000}})
+}
+
+// gatewayContext of requests proxied by the local gateway w x-forwarded-for values
+func gatewayContext(xff ...string) context.Context {
+	md := metadata.MD{"x-forwarded-for": xff}
+	return metadata.NewIncomingContext(peerContext("127.0.0.1"), md)
+}
+
+func TestRateLimitServerInterceptor(t *testing.T) {
+	r := NewRateLimitServerInterceptor(ratelimit.NewMemoryLimiter(), []*configs.RateLimit{
+		{Method: "/api.Service/Login", Key: RateLimitByPeer, Rate: 0.5, Burst: 1},
+	})
+	info := &grpc.UnaryServerInfo{FullMethod: "/api.Service/Login"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	if _, err := r.UnaryInterceptor(peerContext("10.0.0.1"), nil, info, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() error = %v", err)
+	}
+	_, err := r.UnaryInterceptor(peerContext("10.0.0.1"), nil, info, handler)
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("UnaryInterceptor() code = %v, want %v", st.Code(), codes.ResourceExhausted)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retry = ri
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() <= time.Second || retry.GetRetryDelay().AsDuration() > 2*time.Second {
+		t.Errorf("UnaryInterceptor() RetryInfo = %v, want ~2s", retry)
+	}
+
+	// other peer
+	if _, err := r.UnaryInterceptor(peerContext("10.0.0.2"), nil, info, handler); err != nil {
+		t.Errorf("UnaryInterceptor() other peer error = %v", err)
+	}
+	// forged x-forwarded-for of the same client shares its bucket
+	if _, err := r.UnaryInterceptor(gatewayContext("10.0.0.3"), nil, info, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() gateway error = %v", err)
+	}
+	if _, err := r.UnaryInterceptor(gatewayContext("6.6.6.6, 10.0.0.3"), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("UnaryInterceptor() forged x-forwarded-for code = %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+	// unlimited method
+	if _, err := r.UnaryInterceptor(peerContext("10.0.0.1"), nil, &grpc.UnaryServerInfo{FullMethod: "/api.Service/List"}, handler); err != nil {
+		t.Errorf("UnaryInterceptor() unlimited method error = %v", err)
+	}
+}
+
+func TestBucketKey(t *testing.T) {
+	byUser := &configs.RateLimit{Method: "/api.Service/List", Key: RateLimitByUser}
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		limit *configs.RateLimit
+		want  string
+	}{
+		{"global", peerContext("10.0.0.1"), &configs.RateLimit{Method: "/api.Service/List", Key: RateLimitGlobal}, "/api.Service/List"},
+		{"peer", peerContext("10.0.0.1"), &configs.RateLimit{Method: "/api.Service/List", Key: RateLimitByPeer}, "/api.Service/List:peer:10.0.0.1"},
+		{"user", utils.SetContextValue(peerContext("10.0.0.1"), utils.UserIDContextKey, "u1"), byUser, "/api.Service/List:user:u1"},
+		{"anonymous user", peerContext("10.0.0.1"), byUser, "/api.Service/List:peer:10.0.0.1"},
+		{"gateway", gatewayContext("10.0.0.9"), byUser, "/api.Service/List:peer:10.0.0.9"},
+		{"gateway w forged header", gatewayContext("1.2.3.4, 10.0.0.9"), byUser, "/api.Service/List:peer:10.0.0.9"},
+		{"gateway w passed through header", gatewayContext("1.2.3.4", "1.2.3.4, 10.0.0.9"), byUser, "/api.Service/List:peer:10.0.0.9"},
+	}
+	for _, tt := range tests {
+		if got := bucketKey(tt.ctx, tt.limit); got != tt.want {
+			t.Errorf("%s: bucketKey() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
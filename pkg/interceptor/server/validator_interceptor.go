@@ -0,0 +1,111 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/errors"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// generated by protoc-gen-govalidators
+type validator interface {
+	Validate() error
+}
+
+// validation error w field & reason (eg. protoc-gen-validate)
+type fieldValidationError interface {
+	Field() string
+	Reason() string
+}
+
+// Validator interceptor: validate requests w generated Validate()
+type ValidatorServerInterceptor struct {
+	skipMethods map[string]bool
+}
+
+var _ ServerInterceptor = (*ValidatorServerInterceptor)(nil)
+
+func NewValidatorServerInterceptor(skipMethods []string) *ValidatorServerInterceptor {
+	v := &ValidatorServerInterceptor{
+		skipMethods: make(map[string]bool, len(skipMethods)),
+	}
+	for _, method := range skipMethods {
+		v.skipMethods[method] = true
+	}
+	return v
+}
+
+func (v *ValidatorServerInterceptor) Log() log.Factory {
+	return DefaultLogger.With(zap.String("interceptor-name", "validator"))
+}
+
+func (v *ValidatorServerInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return v.UnaryInterceptor
+}
+
+func (v *ValidatorServerInterceptor) Stream() grpc.StreamServerInterceptor {
+	return v.StreamInterceptor
+}
+
+// unary request to grpc server
+func (v *ValidatorServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !v.skipMethods[info.FullMethod] {
+		if err := validate(req); err != nil {
+			v.Log().For(ctx).Info("Invalid request", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// stream request interceptor: validate every received message
+func (v *ValidatorServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if v.skipMethods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	return handler(srv, &validatingServerStream{ServerStream: ss})
+}
+
+type validatingServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+// validate converts validation failure to bad request w field violations
+func validate(req interface{}) error {
+	v, ok := req.(validator)
+	if !ok {
+		return nil
+	}
+	err := v.Validate()
+	if err == nil {
+		return nil
+	}
+	field, reason := fieldViolation(err)
+	return errors.BadRequest("invalid request", map[string]string{field: reason})
+}
+
+// fieldViolation extracts field & reason from validation error
+// go-proto-validators format: `invalid field Field.Nested: reason`
+func fieldViolation(err error) (string, string) {
+	if fe, ok := err.(fieldValidationError); ok {
+		return fe.Field(), fe.Reason()
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "invalid field ") {
+		if i := strings.Index(msg, ": "); i >= 0 {
+			return msg[len("invalid field "):i], msg[i+2:]
+		}
+	}
+	return "request", msg
+}
@@ -0,0 +1,43 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidatorServerInterceptor(t *testing.T) {
+	v := NewValidatorServerInterceptor([]string{"/api.Service/Skip"})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	invalid := &api_v3.UpdateUserRequest{User: &api_v3.User{Role: 99}}
+
+	_, err := v.UnaryInterceptor(context.Background(), invalid, &grpc.UnaryServerInfo{FullMethod: "/api.Service/Update"}, handler)
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("UnaryInterceptor() code = %v, want %v", st.Code(), codes.InvalidArgument)
+	}
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = br.GetFieldViolations()
+		}
+	}
+	if len(violations) != 1 || violations[0].GetField() != "User.Role" {
+		t.Errorf("UnaryInterceptor() violations = %v, want field User.Role", violations)
+	}
+
+	// valid request
+	if _, err := v.UnaryInterceptor(context.Background(), &api_v3.UpdateUserRequest{User: &api_v3.User{}}, &grpc.UnaryServerInfo{FullMethod: "/api.Service/Update"}, handler); err != nil {
+		t.Errorf("UnaryInterceptor() valid request error = %v", err)
+	}
+	// opted out method
+	if _, err := v.UnaryInterceptor(context.Background(), invalid, &grpc.UnaryServerInfo{FullMethod: "/api.Service/Skip"}, handler); err != nil {
+		t.Errorf("UnaryInterceptor() skipped method error = %v", err)
+	}
+}
@@ -14,6 +14,8 @@ import (
 type factory struct {
 	opts   *configs.Log
 	logger *zap.Logger
+	// shared by loggers derived w With, changeable at runtime
+	level zap.AtomicLevel
 }
 
 var _ Factory = (*factory)(nil)
@@ -42,13 +44,20 @@ func NewFactory(opts ...Option) Factory {
 	var logger *zap.Logger
 	var err error
 	if f.opts.Mode == "pro" || f.opts.Mode == "production" {
-		logger, err = zap.NewProduction(
-			zap.IncreaseLevel(level),
+		config := zap.NewProductionConfig()
+		// production logs info at least
+		if level > zapcore.InfoLevel {
+			config.Level.SetLevel(level)
+		}
+		f.level = config.Level
+		logger, err = config.Build(
 			zap.AddStacktrace(traceLevel),
 		)
 	} else {
-		logger, err = zap.NewDevelopment(
-			// zap.IncreaseLevel(level),
+		// development logs everything by default
+		config := zap.NewDevelopmentConfig()
+		f.level = config.Level
+		logger, err = config.Build(
 			zap.AddStacktrace(traceLevel),
 			zap.AddCallerSkip(1),
 		)
@@ -98,7 +107,12 @@ func (f *factory) For(ctx context.Context) Logger {
 
 // Fields set fields to always be logged
 func (f *factory) With(fields ...zapcore.Field) Factory {
-	return &factory{logger: f.logger.With(fields...)}
+	return &factory{logger: f.logger.With(fields...), level: f.level}
+}
+
+// Level gets the atomic level, serves GET/PUT {"level":"info"} over http
+func (f *factory) Level() zap.AtomicLevel {
+	return f.level
 }
 
 // Info logs an info msg with fields
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -21,6 +22,8 @@ type Factory interface {
 	For(ctx context.Context) Logger
 	// Fields set fields to always be logged
 	With(fields ...zapcore.Field) Factory
+	// Level gets the log level changeable at runtime
+	Level() zap.AtomicLevel
 	// Info logs an info msg with fields
 	Info(msg string, fields ...zapcore.Field)
 	// Error logs an error msg with fields
@@ -49,6 +52,11 @@ func With(fields ...zapcore.Field) Factory {
 	return DefaultLogger.With(fields...)
 }
 
+// Level gets the log level of default logger
+func Level() zap.AtomicLevel {
+	return DefaultLogger.Level()
+}
+
 // Info logs an info msg with fields
 func Info(msg string, fields ...zapcore.Field) {
 	DefaultLogger.Info(msg, fields...)
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// grpc call types
+const (
+	Unary        = "unary"
+	ClientStream = "client_stream"
+	ServerStream = "server_stream"
+	BidiStream   = "bidi_stream"
+)
+
+// StreamType returns grpc call type of a streaming rpc
+func StreamType(isClientStream, isServerStream bool) string {
+	switch {
+	case isClientStream && isServerStream:
+		return BidiStream
+	case isClientStream:
+		return ClientStream
+	case isServerStream:
+		return ServerStream
+	default:
+		return Unary
+	}
+}
+
+// SplitMethodName splits full method name `/package.Service/Method` into service & method
+func SplitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
+
+// Register registers collector into the default prometheus registry (shared w jaeger metrics)
+// return the collector registered before if any
+func Register(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Handler serves the default prometheus registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
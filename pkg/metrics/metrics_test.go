@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSplitMethodName(t *testing.T) {
+	tests := []struct {
+		fullMethod      string
+		service, method string
+	}{
+		{"/v3.UserService/Login", "v3.UserService", "Login"},
+		{"v3.UserService/Login", "v3.UserService", "Login"},
+		{"Login", "unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if service, method := SplitMethodName(tt.fullMethod); service != tt.service || method != tt.method {
+			t.Errorf("SplitMethodName(%q) = %q, %q, want %q, %q", tt.fullMethod, service, method, tt.service, tt.method)
+		}
+	}
+}
+
+func TestStreamType(t *testing.T) {
+	if got := StreamType(true, true); got != BidiStream {
+		t.Errorf("StreamType(true, true) = %v", got)
+	}
+	if got := StreamType(true, false); got != ClientStream {
+		t.Errorf("StreamType(true, false) = %v", got)
+	}
+	if got := StreamType(false, true); got != ServerStream {
+		t.Errorf("StreamType(false, true) = %v", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	opts := prometheus.CounterOpts{Name: "metrics_test_total", Help: "test"}
+	first := Register(prometheus.NewCounter(opts))
+	if got := Register(prometheus.NewCounter(opts)); got != first {
+		t.Error("Register() duplicated, want existing collector")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() conflicting help, want panic")
+		}
+	}()
+	Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "metrics_test_total", Help: "other"}))
+}
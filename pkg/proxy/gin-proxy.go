@@ -21,11 +21,14 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/protobuf/runtime/protoiface"
 
+	"github.com/1412335/grpc-rest-microservice/pkg/certs"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
 	"github.com/1412335/grpc-rest-microservice/pkg/tracing"
 	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 
@@ -38,16 +41,40 @@ type Handler struct {
 	logger                  log.Factory
 	config                  *configs.ServiceConfig
 	registerServiceHandlers []RegisterServiceHandler
+	healthClient            healthpb.HealthClient
+	certManager             *certs.Manager
+	endpoint                string
+	dialOptions             []grpc.DialOption
 }
 
 var _ Proxy = (*Handler)(nil)
 
-func NewHandler(config *configs.ServiceConfig, logger log.Factory, registerServiceHandlers []RegisterServiceHandler) *Handler {
-	return &Handler{
+type Option func(*Handler)
+
+// WithEndpoint overrides grpc server address dialed by the gateway (default 0.0.0.0:GRPC.Port)
+func WithEndpoint(endpoint string) Option {
+	return func(h *Handler) {
+		h.endpoint = endpoint
+	}
+}
+
+// WithDialOptions appends options to dial grpc server, eg. grpc.WithContextDialer for in-memory listeners
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(h *Handler) {
+		h.dialOptions = append(h.dialOptions, opts...)
+	}
+}
+
+func NewHandler(config *configs.ServiceConfig, logger log.Factory, registerServiceHandlers []RegisterServiceHandler, opts ...Option) *Handler {
+	h := &Handler{
 		logger:                  logger.With(zap.String("gateway", "gin")),
 		config:                  config,
 		registerServiceHandlers: registerServiceHandlers,
 	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
 
 // isPermanentHTTPHeader checks whether hdr belongs to the list of
@@ -190,6 +217,12 @@ func (h *Handler) initRouter(handler http.Handler) *gin.Engine {
 		h.logger.Bg().Error("Serve OpenAPI", zap.Error(err))
 	}
 
+	// health check endpoints
+	h.serveHealth(r)
+
+	// prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// r.GET("/", func(c *gin.Context) {
 	// 	c.String(http.StatusOK, "Have nice day")
 	// })
@@ -236,23 +269,53 @@ func (h *Handler) serveOpenAPI(r *gin.Engine) error {
 	return nil
 }
 
-func (h *Handler) loadClientTLSCredentials() (credentials.TransportCredentials, error) {
+// load & watch certificates until ctx is done
+func (h *Handler) loadCertManager(ctx context.Context) (*certs.Manager, error) {
+	if h.certManager != nil {
+		return h.certManager, nil
+	}
+	manager, err := certs.NewManager(h.config.TLSCert, certs.WithLoggerFactory(h.logger))
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.Watch(); err != nil {
+		h.logger.For(ctx).Error("Watch certificates failed", zap.Error(err))
+	}
+	go func() {
+		<-ctx.Done()
+		if err := manager.Close(); err != nil {
+			h.logger.For(ctx).Error("Close certificate manager failed", zap.Error(err))
+		}
+	}()
+	h.certManager = manager
+	return manager, nil
+}
+
+func (h *Handler) loadClientTLSCredentials(ctx context.Context) (credentials.TransportCredentials, error) {
 	config, err := utils.LoadClientTLSConfig(h.config.TLSCert.CACert)
 	if err != nil {
 		return nil, err
 	}
+	// grpc server requests client certificates: gateway presents the latest service certificate
+	if h.config.TLSCert.ClientAuth != "" && h.config.TLSCert.ClientAuth != utils.ClientAuthNone {
+		manager, err := h.loadCertManager(ctx)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = manager.GetClientCertificate
+	}
 	// config.ServerName = h.addr
 	config.InsecureSkipVerify = true
 	// Create the credentials and return it
 	return credentials.NewTLS(config), nil
 }
 
-func (h *Handler) loadServerTLSCredentials() (*tls.Config, error) {
-	config, err := utils.LoadServerTLSConfig(h.config.TLSCert.CertPem, h.config.TLSCert.KeyPem)
+func (h *Handler) loadServerTLSCredentials(ctx context.Context) (*tls.Config, error) {
+	manager, err := h.loadCertManager(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
+	return manager.ServerTLSConfigNoClientAuth(), nil
 }
 
 func (h *Handler) RegisterServiceHandlerFromEndpoint(funcs []RegisterServiceHandler) error {
@@ -260,11 +323,9 @@ func (h *Handler) RegisterServiceHandlerFromEndpoint(funcs []RegisterServiceHand
 	return nil
 }
 
-// run grpc-gateway
-func (h *Handler) Run() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
+// HTTPHandler builds the gateway router w/o listening
+// grpc connections are closed when ctx is done
+func (h *Handler) HTTPHandler(ctx context.Context) (http.Handler, error) {
 	// custom http error
 	runtime.HTTPError = errors.CustomHTTPError
 
@@ -284,6 +345,9 @@ func (h *Handler) Run() error {
 	)
 
 	gRPCHost := net.JoinHostPort("0.0.0.0", strconv.Itoa(h.config.GRPC.Port))
+	if h.endpoint != "" {
+		gRPCHost = h.endpoint
+	}
 
 	// gRPC client options
 	opts := []grpc.DialOption{
@@ -292,10 +356,10 @@ func (h *Handler) Run() error {
 
 	// insecure
 	if h.config.EnableTLS && h.config.TLSCert != nil {
-		creds, err := h.loadClientTLSCredentials()
+		creds, err := h.loadClientTLSCredentials(ctx)
 		if err != nil {
 			h.logger.For(ctx).Error("Load client TLS credentials", zap.Error(err))
-			return err
+			return nil, err
 		}
 		opts = []grpc.DialOption{
 			grpc.WithTransportCredentials(creds),
@@ -313,6 +377,7 @@ func (h *Handler) Run() error {
 	if len(callOptions) > 0 {
 		opts = append(opts, grpc.WithDefaultCallOptions(callOptions...))
 	}
+	opts = append(opts, h.dialOptions...)
 
 	for _, registerFunc := range h.registerServiceHandlers {
 		// register handler
@@ -324,14 +389,40 @@ func (h *Handler) Run() error {
 		)
 		if err != nil {
 			h.logger.For(ctx).Error("Register gateway", zap.Error(err))
-			return err
+			return nil, err
 		}
 	}
 
+	// grpc health client for /healthz + /readyz
+	healthConn, err := grpc.DialContext(ctx, gRPCHost, opts...)
+	if err != nil {
+		h.logger.For(ctx).Error("Dial grpc health service", zap.Error(err))
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		if err := healthConn.Close(); err != nil {
+			h.logger.For(ctx).Error("Close grpc health connection", zap.Error(err))
+		}
+	}()
+	h.healthClient = healthpb.NewHealthClient(healthConn)
+
+	// router
+	return h.initRouter(mux), nil
+}
+
+// run grpc-gateway
+func (h *Handler) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	router, err := h.HTTPHandler(ctx)
+	if err != nil {
+		return err
+	}
+
 	// proxy address
 	addr := ":" + strconv.Itoa(h.config.Proxy.Port)
-	// router
-	router := h.initRouter(mux)
 	// http server
 	srv := &http.Server{
 		Addr:    addr,
@@ -340,7 +431,7 @@ func (h *Handler) Run() error {
 
 	// insecure
 	if h.config.EnableTLS && h.config.TLSCert != nil {
-		tlsConfig, err := h.loadServerTLSCredentials()
+		tlsConfig, err := h.loadServerTLSCredentials(ctx)
 		if err != nil {
 			h.logger.For(ctx).Error("Load http server TLS credentials", zap.Error(err))
 			return err
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Service string `json:"service,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// check serving status of grpc server via grpc.health.v1.Health
+func (h *Handler) checkHealth(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	if h.healthClient == nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	rsp, err := h.healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return rsp.GetStatus(), nil
+}
+
+// serveHealth exposes grpc health state on /healthz (liveness) & /readyz (readiness)
+// an optional query param `service` checks a specific grpc service
+func (h *Handler) serveHealth(r *gin.Engine) {
+	// liveness: grpc server is reachable whatever dependencies state
+	r.GET("/healthz", func(c *gin.Context) {
+		service := c.Query("service")
+		st, err := h.checkHealth(c.Request.Context(), service)
+		if err != nil {
+			h.logger.For(c.Request.Context()).Error("Health check", zap.String("service", service), zap.Error(err))
+			c.JSON(http.StatusServiceUnavailable, healthResponse{Status: st.String(), Service: service, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, healthResponse{Status: st.String(), Service: service})
+	})
+	// readiness: grpc server is serving (all dependencies up)
+	r.GET("/readyz", func(c *gin.Context) {
+		service := c.Query("service")
+		st, err := h.checkHealth(c.Request.Context(), service)
+		if err != nil {
+			h.logger.For(c.Request.Context()).Error("Readiness check", zap.String("service", service), zap.Error(err))
+			c.JSON(http.StatusServiceUnavailable, healthResponse{Status: st.String(), Service: service, Error: err.Error()})
+			return
+		}
+		if st != healthpb.HealthCheckResponse_SERVING {
+			c.JSON(http.StatusServiceUnavailable, healthResponse{Status: st.String(), Service: service})
+			return
+		}
+		c.JSON(http.StatusOK, healthResponse{Status: st.String(), Service: service})
+	})
+}
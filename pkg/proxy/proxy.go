@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"google.golang.org/grpc"
@@ -11,5 +12,7 @@ type RegisterServiceHandler func(ctx context.Context, mux *runtime.ServeMux, end
 
 type Proxy interface {
 	Run() error
+	// HTTPHandler returns gateway handler to be served by another listener (eg. multiplexed w grpc)
+	HTTPHandler(ctx context.Context) (http.Handler, error)
 	RegisterServiceHandlerFromEndpoint([]RegisterServiceHandler) error
 }
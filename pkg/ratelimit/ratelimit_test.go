@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewMemoryLimiter().(*memoryLimiter)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// burst
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := l.Allow(ctx, "login", 1, 3); !ok {
+			t.Fatalf("Allow() #%d rejected within burst", i)
+		}
+	}
+	ok, wait, err := l.Allow(ctx, "login", 1, 3)
+	if err != nil || ok {
+		t.Fatalf("Allow() = %v, %v, want rejected", ok, err)
+	}
+	if wait != time.Second {
+		t.Errorf("Allow() wait = %v, want %v", wait, time.Second)
+	}
+
+	// other keys have their own bucket
+	if ok, _, _ := l.Allow(ctx, "list", 1, 3); !ok {
+		t.Error("Allow() other key rejected")
+	}
+
+	// refill
+	now = now.Add(time.Second)
+	if ok, _, _ := l.Allow(ctx, "login", 1, 3); !ok {
+		t.Error("Allow() rejected after refill")
+	}
+
+	// idle buckets are swept
+	now = now.Add(sweepInterval)
+	l.Allow(ctx, "login", 1, 3)
+	if _, ok := l.buckets["list"]; ok {
+		t.Error("idle bucket not swept")
+	}
+}
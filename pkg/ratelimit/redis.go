@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
+)
+
+// redis limiter: buckets shared across replicas
+type redisLimiter struct {
+	store *redis.Redis
+}
+
+var _ Limiter = (*redisLimiter)(nil)
+
+func NewRedisLimiter(store *redis.Redis) Limiter {
+	return &redisLimiter{
+		store: store,
+	}
+}
+
+func (r *redisLimiter) Allow(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	return r.store.TakeToken(ctx, "ratelimit:"+key, rate, burst)
+}
@@ -0,0 +1,246 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultConsulAddress    = "127.0.0.1:8500"
+	defaultCheckInterval    = 10
+	defaultDeregisterAfter  = 60
+	consulIndexHeader       = "X-Consul-Index"
+	consulRegisterPath      = "/v1/agent/service/register"
+	consulDeregisterPath    = "/v1/agent/service/deregister/"
+	consulHealthServicePath = "/v1/health/service/"
+)
+
+// ConsulRegistry registers instances w a grpc health check to the local consul agent
+// & discovers passing instances via blocking queries of the http api
+type ConsulRegistry struct {
+	address         string
+	checkInterval   int
+	deregisterAfter int
+	options         *Options
+}
+
+var _ Registry = (*ConsulRegistry)(nil)
+
+func NewConsulRegistry(config *configs.Consul, opts ...Option) (*ConsulRegistry, error) {
+	options, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	r := &ConsulRegistry{
+		address:         defaultConsulAddress,
+		checkInterval:   defaultCheckInterval,
+		deregisterAfter: defaultDeregisterAfter,
+		options:         options,
+	}
+	if config != nil {
+		if config.AddressConsul != "" {
+			r.address = config.AddressConsul
+		}
+		if config.Interval > 0 {
+			r.checkInterval = config.Interval
+		}
+		if config.DeregisterCriticalServiceAfter > 0 {
+			r.deregisterAfter = config.DeregisterCriticalServiceAfter
+		}
+	}
+	if !strings.Contains(r.address, "://") {
+		r.address = "http://" + r.address
+	}
+	return r, nil
+}
+
+type consulCheck struct {
+	GRPC                           string `json:"GRPC"`
+	Interval                       string `json:"Interval"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+type consulService struct {
+	ID      string       `json:"ID"`
+	Name    string       `json:"Name,omitempty"`
+	Service string       `json:"Service,omitempty"`
+	Tags    []string     `json:"Tags,omitempty"`
+	Address string       `json:"Address"`
+	Port    int          `json:"Port"`
+	Check   *consulCheck `json:"Check,omitempty"`
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service consulService `json:"Service"`
+}
+
+func (r *ConsulRegistry) Register(ctx context.Context, instance *Instance) error {
+	host, port, err := net.SplitHostPort(instance.Address)
+	if err != nil {
+		return err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&consulService{
+		ID:      instance.ID,
+		Name:    instance.Name,
+		Tags:    instance.Tags,
+		Address: host,
+		Port:    p,
+		Check: &consulCheck{
+			GRPC:                           instance.Address,
+			Interval:                       (time.Duration(r.checkInterval) * time.Second).String(),
+			DeregisterCriticalServiceAfter: (time.Duration(r.deregisterAfter) * time.Second).String(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.do(ctx, http.MethodPut, consulRegisterPath, nil, bytes.NewReader(body), nil)
+	return err
+}
+
+func (r *ConsulRegistry) Deregister(ctx context.Context, instance *Instance) error {
+	_, err := r.do(ctx, http.MethodPut, consulDeregisterPath+url.PathEscape(instance.ID), nil, nil, nil)
+	return err
+}
+
+func (r *ConsulRegistry) Resolve(ctx context.Context, name string) ([]*Instance, error) {
+	instances, _, err := r.query(ctx, name, 0)
+	return instances, err
+}
+
+// Watch runs blocking queries, retried w backoff while the agent is unreachable
+func (r *ConsulRegistry) Watch(ctx context.Context, name string) (<-chan []*Instance, error) {
+	instances, index, err := r.query(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []*Instance, 1)
+	ch <- instances
+
+	go func() {
+		defer close(ch)
+		backoff := time.Duration(0)
+		for {
+			if backoff > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+			}
+			latest, latestIndex, err := r.query(ctx, name, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				backoff = nextBackoff(backoff)
+				r.options.logger.Error("Watch consul service failed", zap.String("service", name), zap.Duration("retry-in", backoff), zap.Error(err))
+				continue
+			}
+			backoff = 0
+			// index went backwards: agent restarted, reset
+			if latestIndex < index {
+				latestIndex = 0
+			}
+			index = latestIndex
+			if !equalInstances(instances, latest) {
+				instances = latest
+				notify(ch, instances)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return time.Second
+	}
+	if backoff *= 2; backoff > defaultMaxBackoff {
+		backoff = defaultMaxBackoff
+	}
+	return backoff
+}
+
+// query passing instances, blocks until index changes when index > 0
+func (r *ConsulRegistry) query(ctx context.Context, name string, index uint64) ([]*Instance, uint64, error) {
+	params := url.Values{"passing": []string{"true"}}
+	if index > 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%ds", int(r.options.waitTime.Seconds())))
+	}
+	var entries []consulServiceEntry
+	header, err := r.do(ctx, http.MethodGet, consulHealthServicePath+url.PathEscape(name), params, nil, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	latestIndex, err := strconv.ParseUint(header.Get(consulIndexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("registry: invalid consul index: %w", err)
+	}
+	instances := make([]*Instance, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		instances = append(instances, &Instance{
+			ID:      entry.Service.ID,
+			Name:    entry.Service.Service,
+			Address: net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
+			Tags:    entry.Service.Tags,
+		})
+	}
+	return sortInstances(instances), latestIndex, nil
+}
+
+func (r *ConsulRegistry) do(ctx context.Context, method, path string, params url.Values, body io.Reader, out interface{}) (http.Header, error) {
+	u := r.address + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := r.options.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rsp.Body.Close(); err != nil {
+			r.options.logger.Error("Close consul response body failed", zap.Error(err))
+		}
+	}()
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(rsp.Body)
+		return nil, fmt.Errorf("registry: consul %s %s: %s: %s", method, path, rsp.Status, bytes.TrimSpace(msg))
+	}
+	if out != nil {
+		if err := json.NewDecoder(rsp.Body).Decode(out); err != nil {
+			return nil, err
+		}
+	}
+	return rsp.Header, nil
+}
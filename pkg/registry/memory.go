@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRegistry keeps instances in process, eg. tests w servertest
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	services map[string]map[string]*Instance
+	watchers map[string]map[chan []*Instance]struct{}
+}
+
+var _ Registry = (*MemoryRegistry)(nil)
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: make(map[string]map[string]*Instance),
+		watchers: make(map[string]map[chan []*Instance]struct{}),
+	}
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, instance *Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instances, ok := r.services[instance.Name]
+	if !ok {
+		instances = make(map[string]*Instance)
+		r.services[instance.Name] = instances
+	}
+	instances[instance.ID] = instance
+	r.notifyLocked(instance.Name)
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(_ context.Context, instance *Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services[instance.Name], instance.ID)
+	r.notifyLocked(instance.Name)
+	return nil
+}
+
+func (r *MemoryRegistry) Resolve(_ context.Context, name string) ([]*Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resolveLocked(name), nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, name string) (<-chan []*Instance, error) {
+	ch := make(chan []*Instance, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.watchers[name]; !ok {
+		r.watchers[name] = make(map[chan []*Instance]struct{})
+	}
+	r.watchers[name][ch] = struct{}{}
+	notify(ch, r.resolveLocked(name))
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers[name], ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (r *MemoryRegistry) resolveLocked(name string) []*Instance {
+	instances := make([]*Instance, 0, len(r.services[name]))
+	for _, instance := range r.services[name] {
+		instances = append(instances, instance)
+	}
+	return sortInstances(instances)
+}
+
+func (r *MemoryRegistry) notifyLocked(name string) {
+	instances := r.resolveLocked(name)
+	for ch := range r.watchers[name] {
+		notify(ch, instances)
+	}
+}
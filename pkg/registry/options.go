@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+)
+
+const (
+	defaultRefreshInterval = 30 * time.Second
+	defaultWaitTime        = 5 * time.Minute
+	defaultMaxBackoff      = 30 * time.Second
+)
+
+type Option func(*Options) error
+
+func WithLoggerFactory(logger log.Factory) Option {
+	return func(o *Options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithHTTPClient sets client of the consul http api
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *Options) error {
+		o.httpClient = client
+		return nil
+	}
+}
+
+// WithRefreshInterval sets polling interval of static registry DNS
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			interval = defaultRefreshInterval
+		}
+		o.refreshInterval = interval
+		return nil
+	}
+}
+
+// WithWaitTime sets max duration of consul blocking queries
+func WithWaitTime(wait time.Duration) Option {
+	return func(o *Options) error {
+		if wait <= 0 {
+			wait = defaultWaitTime
+		}
+		o.waitTime = wait
+		return nil
+	}
+}
+
+type Options struct {
+	logger          log.Factory
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	waitTime        time.Duration
+}
+
+func newOptions(opts ...Option) (*Options, error) {
+	o := &Options{
+		logger:          log.DefaultLogger,
+		httpClient:      http.DefaultClient,
+		refreshInterval: defaultRefreshInterval,
+		waitTime:        defaultWaitTime,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+// registry backends
+const (
+	BackendConsul = "consul"
+	BackendStatic = "static"
+	BackendMemory = "memory"
+)
+
+var ErrUnknownBackend = errors.New("registry: unknown backend")
+
+// Instance is an address of a service
+type Instance struct {
+	ID      string
+	Name    string
+	Address string
+	Tags    []string
+}
+
+// Registry registers service instances & discovers them by service name
+type Registry interface {
+	Register(ctx context.Context, instance *Instance) error
+	Deregister(ctx context.Context, instance *Instance) error
+	// Resolve returns healthy instances of service name
+	Resolve(ctx context.Context, name string) ([]*Instance, error)
+	// Watch sends instances of service name on start & every change, closed when ctx is done
+	Watch(ctx context.Context, name string) (<-chan []*Instance, error)
+}
+
+// New creates registry of config backend
+func New(config *configs.Registry, opts ...Option) (Registry, error) {
+	if config == nil {
+		return nil, ErrUnknownBackend
+	}
+	switch config.Backend {
+	case BackendConsul:
+		return NewConsulRegistry(config.Consul, opts...)
+	case BackendStatic:
+		return NewStaticRegistry(config.Services, append([]Option{WithRefreshInterval(config.RefreshInterval)}, opts...)...)
+	case BackendMemory:
+		return NewMemoryRegistry(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, config.Backend)
+	}
+}
+
+// NewInstance describes the instance of service listening on port, overridden by consul config
+func NewInstance(config *configs.Consul, name string, port int) (*Instance, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if c := config; c != nil {
+		if c.Name != "" {
+			name = c.Name
+		}
+		if c.GRPCHost != "" {
+			host = c.GRPCHost
+		}
+		if c.GRPCPort > 0 {
+			port = c.GRPCPort
+		}
+		if c.Tag != "" {
+			tags = []string{c.Tag}
+		}
+	}
+	instance := &Instance{
+		ID:      name + "-" + host + "-" + strconv.Itoa(port),
+		Name:    name,
+		Address: net.JoinHostPort(host, strconv.Itoa(port)),
+		Tags:    tags,
+	}
+	if config != nil && config.ID != "" {
+		instance.ID = config.ID
+	}
+	return instance, nil
+}
+
+// sort by address, instances are compared to detect changes
+func sortInstances(instances []*Instance) []*Instance {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Address < instances[j].Address
+	})
+	return instances
+}
+
+func equalInstances(a, b []*Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Address != b[i].Address {
+			return false
+		}
+	}
+	return true
+}
+
+// send latest instances, replace a value not received yet
+func notify(ch chan []*Instance, instances []*Instance) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- instances
+}
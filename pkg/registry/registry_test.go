@@ -0,0 +1,233 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+)
+
+func addresses(instances []*Instance) []string {
+	addrs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		addrs = append(addrs, instance.Address)
+	}
+	return addrs
+}
+
+func receive(t *testing.T, ch <-chan []*Instance) []string {
+	t.Helper()
+	select {
+	case instances := <-ch:
+		return addresses(instances)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no instances received")
+		return nil
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.Watch(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, ch); len(got) != 0 {
+		t.Errorf("Watch() = %v, want empty", got)
+	}
+
+	a := &Instance{ID: "a", Name: "user", Address: "10.0.0.2:9090"}
+	b := &Instance{ID: "b", Name: "user", Address: "10.0.0.1:9090"}
+	_ = r.Register(ctx, a)
+	_ = r.Register(ctx, b)
+	_ = r.Register(ctx, &Instance{ID: "c", Name: "order", Address: "10.0.0.3:9090"})
+
+	// latest state only
+	if got, want := receive(t, ch), []string{"10.0.0.1:9090", "10.0.0.2:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+	_ = r.Deregister(ctx, b)
+	if got, want := receive(t, ch), []string{"10.0.0.2:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+	instances, _ := r.Resolve(ctx, "user")
+	if got, want := addresses(instances), []string{"10.0.0.2:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %v, want %v", got, want)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestStaticRegistry(t *testing.T) {
+	r, err := NewStaticRegistry(map[string][]string{
+		"user": {"10.0.0.1:9090", "user.svc:9090"},
+	}, WithRefreshInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	hosts := []string{"10.0.1.1"}
+	r.lookup = func(_ context.Context, host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if host != "user.svc" {
+			return nil, errors.New("no such host")
+		}
+		return hosts, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := r.Watch(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receive(t, ch), []string{"10.0.0.1:9090", "10.0.1.1:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+
+	// DNS change
+	mu.Lock()
+	hosts = []string{"10.0.1.1", "10.0.1.2"}
+	mu.Unlock()
+	if got, want := receive(t, ch), []string{"10.0.0.1:9090", "10.0.1.1:9090", "10.0.1.2:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+
+	if instances, err := r.Resolve(ctx, "order"); err != nil || len(instances) != 0 {
+		t.Errorf("Resolve() unknown service = %v, %v, want empty", instances, err)
+	}
+}
+
+// fake consul agent: registered services are passing, blocking queries return on change
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string]consulService
+	changed  chan struct{}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == consulRegisterPath:
+		var svc consulService
+		if err := json.NewDecoder(r.Body).Decode(&svc); err != nil || svc.Check == nil || svc.Check.GRPC == "" {
+			http.Error(w, "invalid service", http.StatusBadRequest)
+			return
+		}
+		svc.Service = svc.Name
+		f.update(func() { f.services[svc.ID] = svc })
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, consulDeregisterPath):
+		f.update(func() { delete(f.services, strings.TrimPrefix(r.URL.Path, consulDeregisterPath)) })
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, consulHealthServicePath):
+		name := strings.TrimPrefix(r.URL.Path, consulHealthServicePath)
+		f.mu.Lock()
+		changed := f.changed
+		index := f.index
+		f.mu.Unlock()
+		if wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); wait >= index {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		f.mu.Lock()
+		var entries []consulServiceEntry
+		for _, svc := range f.services {
+			if svc.Service == name {
+				entry := consulServiceEntry{Service: svc}
+				entry.Node.Address = "10.0.0.100"
+				entries = append(entries, entry)
+			}
+		}
+		w.Header().Set(consulIndexHeader, strconv.FormatUint(f.index, 10))
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) update(change func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	change()
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func TestConsulRegistry(t *testing.T) {
+	agent := &fakeConsul{index: 1, services: make(map[string]consulService), changed: make(chan struct{})}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	r, err := New(&configs.Registry{
+		Backend: BackendConsul,
+		Consul:  &configs.Consul{AddressConsul: srv.URL, Interval: 5, DeregisterCriticalServiceAfter: 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := r.Watch(ctx, "user")
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if got := receive(t, ch); len(got) != 0 {
+		t.Errorf("Watch() = %v, want empty", got)
+	}
+
+	instance, err := NewInstance(&configs.Consul{ID: "user-1", Tag: "v3", GRPCHost: "10.0.0.1"}, "user", 9090)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(ctx, instance); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got, want := receive(t, ch), []string{"10.0.0.1:9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+	agent.mu.Lock()
+	check := agent.services["user-1"].Check
+	agent.mu.Unlock()
+	if check.Interval != "5s" || check.DeregisterCriticalServiceAfter != "30s" {
+		t.Errorf("check = %+v, want 5s interval & deregistered after 30s", check)
+	}
+
+	instances, err := r.Resolve(ctx, "user")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(instances) != 1 || instances[0].ID != "user-1" || !reflect.DeepEqual(instances[0].Tags, []string{"v3"}) {
+		t.Errorf("Resolve() = %+v, want user-1 tagged v3", instances)
+	}
+
+	if err := r.Deregister(ctx, instance); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if got := receive(t, ch); len(got) != 0 {
+		t.Errorf("Watch() = %v, want empty", got)
+	}
+}
+
+func TestNew_UnknownBackend(t *testing.T) {
+	if _, err := New(&configs.Registry{Backend: "zookeeper"}); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("New() error = %v, want %v", err, ErrUnknownBackend)
+	}
+}
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme of grpc targets resolved by registry, eg. registry:///user
+const Scheme = "registry"
+
+// resolverBuilder watches instances of target service name
+type resolverBuilder struct {
+	registry Registry
+}
+
+// NewResolverBuilder creates grpc resolver of registry:///<service>, use w grpc.WithResolvers
+func NewResolverBuilder(r Registry) resolver.Builder {
+	return &resolverBuilder{registry: r}
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	name := strings.TrimPrefix(target.Endpoint, "/")
+	ch, err := b.registry.Watch(ctx, name)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r := &registryResolver{cancel: cancel, done: make(chan struct{})}
+	go r.watch(cc, ch)
+	return r, nil
+}
+
+type registryResolver struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *registryResolver) watch(cc resolver.ClientConn, ch <-chan []*Instance) {
+	defer close(r.done)
+	for instances := range ch {
+		addrs := make([]resolver.Address, 0, len(instances))
+		for _, instance := range instances {
+			addrs = append(addrs, resolver.Address{Addr: instance.Address})
+		}
+		cc.UpdateState(resolver.State{Addresses: addrs})
+	}
+}
+
+// ResolveNow is no-op, instances are pushed by Watch
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+	<-r.done
+}
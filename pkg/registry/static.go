@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StaticRegistry resolves configured addresses, host names are looked up via DNS
+// instances come from config: Register & Deregister are no-op
+type StaticRegistry struct {
+	services map[string][]string
+	lookup   func(ctx context.Context, host string) ([]string, error)
+	options  *Options
+}
+
+var _ Registry = (*StaticRegistry)(nil)
+
+func NewStaticRegistry(services map[string][]string, opts ...Option) (*StaticRegistry, error) {
+	options, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticRegistry{
+		services: services,
+		lookup:   net.DefaultResolver.LookupHost,
+		options:  options,
+	}, nil
+}
+
+func (r *StaticRegistry) Register(context.Context, *Instance) error {
+	return nil
+}
+
+func (r *StaticRegistry) Deregister(context.Context, *Instance) error {
+	return nil
+}
+
+func (r *StaticRegistry) Resolve(ctx context.Context, name string) ([]*Instance, error) {
+	var instances []*Instance
+	for _, addr := range r.services[name] {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		hosts := []string{host}
+		if net.ParseIP(host) == nil {
+			if hosts, err = r.lookup(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+		for _, h := range hosts {
+			address := net.JoinHostPort(h, port)
+			instances = append(instances, &Instance{ID: address, Name: name, Address: address})
+		}
+	}
+	return sortInstances(instances), nil
+}
+
+// Watch polls DNS each refresh interval, last instances are kept on lookup failure
+func (r *StaticRegistry) Watch(ctx context.Context, name string) (<-chan []*Instance, error) {
+	instances, err := r.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []*Instance, 1)
+	ch <- instances
+
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(r.options.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := r.Resolve(ctx, name)
+			if err != nil {
+				r.options.logger.Error("Resolve static service failed", zap.String("service", name), zap.Error(err))
+				continue
+			}
+			if !equalInstances(instances, latest) {
+				instances = latest
+				notify(ch, instances)
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/metrics"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// admin & metrics are served on loopback unless Admin.Host / Admin.MetricsHost is set
+const defaultAdminHost = "127.0.0.1"
+
+// config keys containing these words are redacted in /debug/config
+var secretKeys = []string{"password", "secret", "token"}
+
+// captures channelz service implementation to serve it over http
+type channelzRegistrar struct {
+	server channelzgrpc.ChannelzServer
+}
+
+func (c *channelzRegistrar) RegisterService(_ *grpc.ServiceDesc, impl interface{}) {
+	c.server, _ = impl.(channelzgrpc.ChannelzServer)
+}
+
+// admin http server: prometheus metrics, pprof, expvar, channelz, config dump & log level
+// NOTE: must not be exposed publicly, only the metrics server (Admin.MetricsPort) may be reachable by prometheus
+func (s *Server) newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	if s.config.Admin.MetricsPort <= 0 {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+
+	// pprof
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// expvar
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// channelz
+	channelz := &channelzRegistrar{}
+	channelzsvc.RegisterChannelzServiceToServer(channelz)
+	mux.HandleFunc("/debug/channelz/channels", func(w http.ResponseWriter, r *http.Request) {
+		rsp, err := channelz.server.GetTopChannels(r.Context(), &channelzgrpc.GetTopChannelsRequest{StartChannelId: queryInt64(r, "start")})
+		s.writeProto(w, rsp, err)
+	})
+	mux.HandleFunc("/debug/channelz/servers", func(w http.ResponseWriter, r *http.Request) {
+		rsp, err := channelz.server.GetServers(r.Context(), &channelzgrpc.GetServersRequest{StartServerId: queryInt64(r, "start")})
+		s.writeProto(w, rsp, err)
+	})
+	mux.HandleFunc("/debug/channelz/sockets", func(w http.ResponseWriter, r *http.Request) {
+		rsp, err := channelz.server.GetServerSockets(r.Context(), &channelzgrpc.GetServerSocketsRequest{
+			ServerId:      queryInt64(r, "server"),
+			StartSocketId: queryInt64(r, "start"),
+		})
+		s.writeProto(w, rsp, err)
+	})
+
+	// build info & config
+	mux.HandleFunc("/debug/config", s.serveConfig)
+
+	// log level: GET or PUT {"level":"debug"}
+	mux.Handle("/debug/loglevel", s.logger.Level())
+
+	return &http.Server{
+		Addr:    adminAddr(s.config.Admin.Host, s.config.Admin.Port),
+		Handler: mux,
+	}
+}
+
+// metrics http server: prometheus metrics only
+func (s *Server) newMetricsServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return &http.Server{
+		Addr:    adminAddr(s.config.Admin.MetricsHost, s.config.Admin.MetricsPort),
+		Handler: mux,
+	}
+}
+
+func adminAddr(host string, port int) string {
+	if host == "" {
+		host = defaultAdminHost
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func queryInt64(r *http.Request, key string) int64 {
+	v, _ := strconv.ParseInt(r.URL.Query().Get(key), 10, 64)
+	return v
+}
+
+func (s *Server) writeProto(w http.ResponseWriter, m proto.Message, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := protojson.MarshalOptions{Indent: "  "}.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		s.logger.Error("Write admin response failed", zap.Error(err))
+	}
+}
+
+type buildInfo struct {
+	GoVersion string `json:"goVersion"`
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	build := buildInfo{GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.Path = info.Main.Path
+		build.Version = info.Main.Version
+	}
+
+	config, err := redactedConfig(s.config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{
+		"service": s.config.ServiceName,
+		"version": s.config.Version,
+		"build":   build,
+		"config":  config,
+	}); err != nil {
+		s.logger.Error("Write admin response failed", zap.Error(err))
+	}
+}
+
+// redactedConfig converts config to generic json w secrets redacted
+func redactedConfig(config interface{}) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return redact("", v), nil
+}
+
+func redact(key string, v interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(lower, secret) {
+			return "REDACTED"
+		}
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = redact(k, val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redact(key, val)
+		}
+		return t
+	case string:
+		// credentials in urls, eg. redis://:password@host:6379
+		if u, err := url.Parse(t); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				return u.String()
+			}
+		}
+		return t
+	default:
+		return t
+	}
+}
+
+// start admin & metrics http servers in background if configured
+func (s *Server) runAdmin(ctx context.Context) {
+	if s.config.Admin == nil {
+		return
+	}
+	if s.config.Admin.Port > 0 {
+		s.adminServer = s.newAdminServer()
+		s.listenAndServe(ctx, "admin", s.adminServer)
+	}
+	if s.config.Admin.MetricsPort > 0 {
+		s.metricsServer = s.newMetricsServer()
+		s.listenAndServe(ctx, "metrics", s.metricsServer)
+	}
+}
+
+func (s *Server) listenAndServe(ctx context.Context, name string, srv *http.Server) {
+	go func() {
+		s.logger.For(ctx).Info("Starting "+name+" server", zap.String("at", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.For(ctx).Error("Server failed", zap.String("server", name), zap.Error(err))
+		}
+	}()
+}
+
+func (s *Server) stopAdmin(ctx context.Context) {
+	for name, srv := range map[string]*http.Server{"admin": s.adminServer, "metrics": s.metricsServer} {
+		if srv == nil {
+			continue
+		}
+		shutdown, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := srv.Shutdown(shutdown); err != nil {
+			s.logger.For(ctx).Error("Server shutdown failed", zap.String("server", name), zap.Error(err))
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAdminServer(t *testing.T) {
+	s := NewServer(&configs.ServiceConfig{
+		ServiceName: "test",
+		Admin:       &configs.Admin{Port: 9100},
+		JWT:         &configs.JWT{SecretKey: "lu", Issuer: "lu"},
+		Database:    &configs.Database{User: "root", Password: "root"},
+		Redis:       &configs.Redis{Nodes: []string{"redis://:pass@redis:6379"}},
+	})
+	admin := s.newAdminServer()
+	// loopback unless configured
+	if admin.Addr != "127.0.0.1:9100" {
+		t.Errorf("admin addr = %s, want 127.0.0.1:9100", admin.Addr)
+	}
+	handler := admin.Handler
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// config dump w secrets redacted
+	w := serve(http.MethodGet, "/debug/config", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /debug/config status = %d", w.Code)
+	}
+	var dump struct {
+		Config struct {
+			JWT      map[string]interface{}
+			Database map[string]interface{}
+			Redis    struct{ Nodes []string }
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Config.JWT["SecretKey"] != "REDACTED" || dump.Config.Database["Password"] != "REDACTED" {
+		t.Errorf("secrets not redacted: %s", w.Body.String())
+	}
+	if dump.Config.JWT["Issuer"] != "lu" || dump.Config.Database["User"] != "root" {
+		t.Errorf("non-secrets redacted: %s", w.Body.String())
+	}
+	if len(dump.Config.Redis.Nodes) != 1 || strings.Contains(dump.Config.Redis.Nodes[0], "pass") {
+		t.Errorf("url password not redacted: %v", dump.Config.Redis.Nodes)
+	}
+
+	// runtime log level
+	level := s.logger.Level().Level()
+	defer s.logger.Level().SetLevel(level)
+	if w := serve(http.MethodPut, "/debug/loglevel", `{"level":"error"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT /debug/loglevel status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := s.logger.Level().Level(); got != zapcore.ErrorLevel {
+		t.Errorf("log level = %v, want %v", got, zapcore.ErrorLevel)
+	}
+
+	// introspection
+	for _, path := range []string{"/debug/pprof/", "/debug/vars", "/debug/channelz/servers", "/debug/channelz/channels", "/metrics"} {
+		if w := serve(http.MethodGet, path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d", path, w.Code)
+		}
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+	s := NewServer(&configs.ServiceConfig{
+		ServiceName: "test",
+		Admin:       &configs.Admin{Port: 9100, MetricsHost: "0.0.0.0", MetricsPort: 9101},
+	})
+	admin, metrics := s.newAdminServer(), s.newMetricsServer()
+	if admin.Addr != "127.0.0.1:9100" {
+		t.Errorf("admin addr = %s, want 127.0.0.1:9100", admin.Addr)
+	}
+	if metrics.Addr != "0.0.0.0:9101" {
+		t.Errorf("metrics addr = %s, want 0.0.0.0:9101", metrics.Addr)
+	}
+
+	tests := []struct {
+		name   string
+		server *http.Server
+		method string
+		path   string
+		want   int
+	}{
+		{"metrics", metrics, http.MethodGet, "/metrics", http.StatusOK},
+		{"metrics log level", metrics, http.MethodPut, "/debug/loglevel", http.StatusNotFound},
+		{"metrics config", metrics, http.MethodGet, "/debug/config", http.StatusNotFound},
+		{"metrics pprof", metrics, http.MethodGet, "/debug/pprof/", http.StatusNotFound},
+		{"admin metrics", admin, http.MethodGet, "/metrics", http.StatusNotFound},
+		{"admin config", admin, http.MethodGet, "/debug/config", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.server.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"level":"error"}`)))
+		if w.Code != tt.want {
+			t.Errorf("%s: %s %s status = %d, want %d", tt.name, tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
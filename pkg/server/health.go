@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 3 * time.Second
+)
+
+// HealthCheckFunc probes a dependency (db, redis, ...) of the service
+type HealthCheckFunc func(ctx context.Context) error
+
+// healthChecker runs the registered probes periodically
+// and reflects the result into the grpc health server
+type healthChecker struct {
+	logger   log.Factory
+	server   *health.Server
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]HealthCheckFunc
+	failures map[string]error
+	services []string
+	shutdown bool
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newHealthChecker(config *configs.HealthCheck, logger log.Factory) *healthChecker {
+	h := &healthChecker{
+		logger:   logger.With(zap.String("health", "grpc")),
+		server:   health.NewServer(),
+		interval: defaultHealthCheckInterval,
+		timeout:  defaultHealthCheckTimeout,
+		checks:   make(map[string]HealthCheckFunc),
+		failures: make(map[string]error),
+		done:     make(chan struct{}),
+	}
+	if config != nil {
+		if config.Interval > 0 {
+			h.interval = config.Interval
+		}
+		if config.Timeout > 0 {
+			h.timeout = config.Timeout
+		}
+	}
+	return h
+}
+
+// add dependency probe
+func (h *healthChecker) register(name string, check HealthCheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// load service names registered on grpc server (except grpc.* internal services: reflection, health)
+func (h *healthChecker) loadServices(srv *grpc.Server) {
+	var services []string
+	for name := range srv.GetServiceInfo() {
+		if strings.HasPrefix(name, "grpc.") {
+			continue
+		}
+		services = append(services, name)
+	}
+	sort.Strings(services)
+
+	h.mu.Lock()
+	h.services = services
+	h.mu.Unlock()
+}
+
+// probe all dependencies & set serving status
+func (h *healthChecker) probe(ctx context.Context) {
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make(map[string]HealthCheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	failures := make(map[string]error)
+	for _, name := range names {
+		checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		if err := checks[name](checkCtx); err != nil {
+			failures[name] = err
+		}
+		cancel()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown {
+		return
+	}
+	// log transitions
+	for _, name := range names {
+		prev, curr := h.failures[name], failures[name]
+		switch {
+		case prev == nil && curr != nil:
+			h.logger.Bg().Error("Dependency is down", zap.String("dependency", name), zap.Error(curr))
+		case prev != nil && curr == nil:
+			h.logger.Bg().Info("Dependency is up", zap.String("dependency", name))
+		}
+	}
+	h.failures = failures
+
+	status := healthpb.HealthCheckResponse_SERVING
+	if len(failures) > 0 {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	// empty service name: overall server health
+	h.server.SetServingStatus("", status)
+	for _, service := range h.services {
+		h.server.SetServingStatus(service, status)
+	}
+}
+
+// start probing in background
+func (h *healthChecker) start() {
+	h.probe(context.Background())
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+				h.probe(context.Background())
+			}
+		}
+	}()
+}
+
+// stop probing & set all services NOT_SERVING
+func (h *healthChecker) stop() {
+	h.stopOnce.Do(func() {
+		close(h.done)
+		h.mu.Lock()
+		h.shutdown = true
+		h.mu.Unlock()
+		h.server.Shutdown()
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthChecker(t *testing.T) {
+	var dbErr error
+	h := newHealthChecker(nil, log.DefaultLogger)
+	h.register("postgres", func(ctx context.Context) error { return dbErr })
+
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, h.server)
+	srv.RegisterService(&grpc.ServiceDesc{ServiceName: "api.TestService", HandlerType: (*interface{})(nil)}, struct{}{})
+	h.loadServices(srv)
+
+	check := func(service string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		rsp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q) error = %v", service, err)
+		}
+		if rsp.GetStatus() != want {
+			t.Errorf("Check(%q) = %v, want %v", service, rsp.GetStatus(), want)
+		}
+	}
+
+	h.probe(context.Background())
+	check("", healthpb.HealthCheckResponse_SERVING)
+	check("api.TestService", healthpb.HealthCheckResponse_SERVING)
+
+	// dependency down
+	dbErr = errors.New("connection refused")
+	h.probe(context.Background())
+	check("", healthpb.HealthCheckResponse_NOT_SERVING)
+	check("api.TestService", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// dependency up again
+	dbErr = nil
+	h.probe(context.Background())
+	check("api.TestService", healthpb.HealthCheckResponse_SERVING)
+
+	// graceful stop
+	h.stop()
+	h.probe(context.Background())
+	check("api.TestService", healthpb.HealthCheckResponse_NOT_SERVING)
+}
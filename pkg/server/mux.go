@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Gateway provides http handler (eg. grpc-gateway) served along w grpc on a single port
+type Gateway interface {
+	HTTPHandler(ctx context.Context) (http.Handler, error)
+}
+
+// WithGateway multiplexes grpc & gateway on GRPC.Port
+func WithGateway(gateway Gateway) Option {
+	return func(s *Server) error {
+		s.gateway = gateway
+		return nil
+	}
+}
+
+// isGRPCRequest checks http/2 request w content-type application/grpc[+proto|+json...]
+func isGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// route grpc requests to grpc server, the rest to gateway
+func (s *Server) muxHandler(gateway http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			s.grpcServer.ServeHTTP(w, r)
+			return
+		}
+		gateway.ServeHTTP(w, r)
+	})
+}
+
+// http server serving both grpc & gateway
+// gateway connections are closed when ctx is done
+func (s *Server) newMuxServer(ctx context.Context) (*http.Server, error) {
+	gateway, err := s.gateway.HTTPHandler(ctx)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Handler: s.muxHandler(gateway),
+	}
+
+	// insecure: http/2 negotiated via ALPN, same certificates & client auth as grpc
+	if s.certManager != nil {
+		srv.TLSConfig = s.certManager.ServerTLSConfig()
+		return srv, nil
+	}
+
+	// plaintext: grpc clients use http/2 w/o TLS (h2c)
+	srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{})
+	return srv, nil
+}
+
+func (s *Server) serveMux(srv *http.Server, listen net.Listener) error {
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(listen, "", "")
+	} else {
+		err = srv.Serve(listen)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// stop gateway & grpc server together
+// NOTE: grpc GracefulStop is not supported w ServeHTTP, so wait for in-flight http requests then stop grpc
+func (s *Server) stopMux(ctx context.Context, srv *http.Server) {
+	shutdown, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		s.logger.For(ctx).Error("Multiplexing server shutdown failed", zap.Error(err))
+	}
+	s.grpcServer.Stop()
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testGateway struct{}
+
+func (testGateway) HTTPHandler(ctx context.Context) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("gateway"))
+	}), nil
+}
+
+func TestMuxServer(t *testing.T) {
+	s := NewServer(&configs.ServiceConfig{ServiceName: "test", GRPC: &configs.GRPC{}}, WithGateway(testGateway{}))
+	s.health.probe(context.Background())
+
+	muxServer, err := s.newMuxServer(context.Background())
+	if err != nil {
+		t.Fatalf("newMuxServer() error = %v", err)
+	}
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.serveMux(muxServer, listen) }()
+
+	// grpc over h2c
+	conn, err := grpc.Dial(listen.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rsp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("grpc Check() error = %v", err)
+	}
+	if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("grpc Check() = %v, want SERVING", rsp.GetStatus())
+	}
+
+	// http/1.1 to gateway
+	httpRsp, err := http.Get("http://" + listen.Addr().String() + "/v3/users")
+	if err != nil {
+		t.Fatalf("http Get() error = %v", err)
+	}
+	body, _ := ioutil.ReadAll(httpRsp.Body)
+	httpRsp.Body.Close()
+	if string(body) != "gateway" {
+		t.Errorf("http Get() = %q, want %q", body, "gateway")
+	}
+
+	// single shutdown path stops both
+	s.stopMux(context.Background(), muxServer)
+	if err := <-done; err != nil {
+		t.Errorf("serveMux() error = %v", err)
+	}
+}
@@ -3,21 +3,25 @@ package server
 import (
 	"context"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 
+	"github.com/1412335/grpc-rest-microservice/pkg/certs"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	interceptor "github.com/1412335/grpc-rest-microservice/pkg/interceptor/server"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/registry"
 	"github.com/1412335/grpc-rest-microservice/pkg/tracing"
-	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 
 	otgrpc "github.com/opentracing-contrib/go-grpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -37,11 +41,44 @@ func WithInterceptors(interceptor ...interceptor.ServerInterceptor) Option {
 	}
 }
 
+// WithHealthCheck registers a dependency probe used by the grpc health service
+func WithHealthCheck(name string, check HealthCheckFunc) Option {
+	return func(s *Server) error {
+		s.healthChecks = append(s.healthChecks, healthCheck{name: name, check: check})
+		return nil
+	}
+}
+
+// WithRegistry registers the server instance on start & deregisters on shutdown, override config Registry
+func WithRegistry(r registry.Registry) Option {
+	return func(s *Server) error {
+		s.registry = r
+		return nil
+	}
+}
+
+type healthCheck struct {
+	name  string
+	check HealthCheckFunc
+}
+
 type Server struct {
-	config       *configs.ServiceConfig
-	grpcServer   *grpc.Server
-	logger       log.Factory
-	interceptors []interceptor.ServerInterceptor
+	config        *configs.ServiceConfig
+	grpcServer    *grpc.Server
+	logger        log.Factory
+	interceptors  []interceptor.ServerInterceptor
+	healthChecks  []healthCheck
+	health        *healthChecker
+	adminServer   *http.Server
+	metricsServer *http.Server
+	gateway       Gateway
+	certManager   *certs.Manager
+	registry      registry.Registry
+
+	mu           sync.Mutex
+	muxServer    *http.Server
+	closeGateway context.CancelFunc
+	instance     *registry.Instance
 }
 
 func NewServer(srvConfig *configs.ServiceConfig, opt ...Option) *Server {
@@ -57,6 +94,16 @@ func NewServer(srvConfig *configs.ServiceConfig, opt ...Option) *Server {
 		return nil
 	}
 
+	// service registry
+	if srv.registry == nil && srvConfig.Registry != nil {
+		r, err := registry.New(srvConfig.Registry, registry.WithLoggerFactory(srv.logger))
+		if err != nil {
+			srv.logger.Error("Create service registry error", zap.Error(err))
+			return nil
+		}
+		srv.registry = r
+	}
+
 	// server options
 	opts := []grpc.ServerOption{}
 
@@ -75,6 +122,13 @@ func NewServer(srvConfig *configs.ServiceConfig, opt ...Option) *Server {
 	// grpc reflection: use with evans
 	reflection.Register(srv.grpcServer)
 
+	// grpc health service w dependency probes
+	srv.health = newHealthChecker(srvConfig.HealthCheck, srv.logger)
+	for _, hc := range srv.healthChecks {
+		srv.health.register(hc.name, hc.check)
+	}
+	healthpb.RegisterHealthServer(srv.grpcServer, srv.health.server)
+
 	return srv
 }
 
@@ -92,23 +146,27 @@ func (s *Server) setLogger() {
 	s.logger = log.With(zap.String("service", s.config.ServiceName), zap.String("version", s.config.Version))
 }
 
-func (s *Server) loadServerTLSCredentials() (credentials.TransportCredentials, error) {
-	config, err := utils.LoadServerTLSConfig(s.config.TLSCert.CertPem, s.config.TLSCert.KeyPem)
+// load & watch certificates: rotated key pair is served w/o restarting
+func (s *Server) loadCertManager() (*certs.Manager, error) {
+	manager, err := certs.NewManager(s.config.TLSCert, certs.WithLoggerFactory(s.logger))
 	if err != nil {
 		return nil, err
 	}
-	// Create the credentials and return it
-	return credentials.NewTLS(config), nil
+	if err := manager.Watch(); err != nil {
+		s.logger.Error("Watch certificates failed", zap.Error(err))
+	}
+	return manager, nil
 }
 
 func (s *Server) insecureServer() grpc.ServerOption {
-	creds, err := s.loadServerTLSCredentials()
+	manager, err := s.loadCertManager()
 	if err != nil {
 		s.logger.Fatal("Failed to parse key pair:", zap.Error(err))
 		return nil
 	}
+	s.certManager = manager
 	// return grpc.Creds(credentials.NewServerTLSFromCert(&utils.Cert))
-	return grpc.Creds(creds)
+	return grpc.Creds(credentials.NewTLS(manager.ServerTLSConfig()))
 }
 
 func (s *Server) tracingInterceptor() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
@@ -136,6 +194,13 @@ func (s *Server) buildServerInterceptors() []grpc.ServerOption {
 		streamInterceptors = append(streamInterceptors, streamTracing)
 	}
 
+	// prometheus metrics
+	if s.config.EnableMetrics {
+		metricsInterceptor := interceptor.NewMetricsServerInterceptor()
+		unaryInterceptors = append(unaryInterceptors, metricsInterceptor.Unary())
+		streamInterceptors = append(streamInterceptors, metricsInterceptor.Stream())
+	}
+
 	// server interceptor
 	interceptor.DefaultLogger = s.logger.With(zap.String("interceptor-type", "server"))
 	for _, i := range s.interceptors {
@@ -143,6 +208,13 @@ func (s *Server) buildServerInterceptors() []grpc.ServerOption {
 		streamInterceptors = append(streamInterceptors, i.Stream())
 	}
 
+	// validate requests right before handlers
+	if s.config.EnableValidation {
+		validator := interceptor.NewValidatorServerInterceptor(s.config.SkipValidationMethods)
+		unaryInterceptors = append(unaryInterceptors, validator.Unary())
+		streamInterceptors = append(streamInterceptors, validator.Stream())
+	}
+
 	// create grpc server
 	return []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(unaryInterceptors...),
@@ -160,27 +232,137 @@ func (s *Server) Run(registerService func(*grpc.Server) error, stopper func()) e
 		return err
 	}
 
+	// graceful shutdown
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		s.logger.For(ctx).Error("Shutting down gRPC server", zap.Stringer("signal", sig))
+		s.Stop()
+		stopper()
+	}()
+
+	return s.Serve(listen, registerService)
+}
+
+// Serve registers implementation services & serves grpc (+ gateway) on listen until Stop is called
+// NOTE: signals are not handled, use Run in main
+func (s *Server) Serve(listen net.Listener, registerService func(*grpc.Server) error) error {
+	ctx := context.Background()
+
 	// register implementation services server
 	if err := registerService(s.grpcServer); err != nil {
 		s.logger.For(ctx).Error("Register service failed", zap.Error(err))
 		return err
 	}
 
-	// graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		select {
-		case sig := <-c:
-			s.logger.For(ctx).Error("Shutting down gRPC server", zap.Stringer("signal", sig))
-			s.grpcServer.GracefulStop()
-			stopper()
-			<-ctx.Done()
+	// grpc + gateway on the same listener
+	var muxServer *http.Server
+	gatewayCtx, closeGateway := context.WithCancel(ctx)
+	if s.gateway != nil {
+		var err error
+		muxServer, err = s.newMuxServer(gatewayCtx)
+		if err != nil {
+			closeGateway()
+			s.logger.For(ctx).Error("Create multiplexing server failed", zap.Error(err))
+			return err
 		}
-	}()
+	}
+	s.mu.Lock()
+	s.muxServer = muxServer
+	s.closeGateway = closeGateway
+	s.mu.Unlock()
+
+	// start probing dependencies
+	s.health.loadServices(s.grpcServer)
+	s.health.start()
+
+	// admin http server
+	s.runAdmin(ctx)
+
+	// discoverable once serving
+	if err := s.register(ctx, listen.Addr()); err != nil {
+		s.logger.For(ctx).Error("Register service instance failed", zap.Error(err))
+	}
+
+	if muxServer != nil {
+		s.logger.For(ctx).Info("Starting gRPC + gateway server", zap.Stringer("at", listen.Addr()))
+		return s.serveMux(muxServer, listen)
+	}
 
-	s.logger.For(ctx).Info("Starting gRPC server", zap.String("at", host))
+	s.logger.For(ctx).Info("Starting gRPC server", zap.Stringer("at", listen.Addr()))
 
 	// run grpc server
 	return s.grpcServer.Serve(listen)
 }
+
+// Stop drains connections & releases resources, Serve returns afterward
+func (s *Server) Stop() {
+	ctx := context.Background()
+	s.mu.Lock()
+	muxServer, closeGateway := s.muxServer, s.closeGateway
+	s.mu.Unlock()
+
+	// stop receiving new clients & mark NOT_SERVING before draining connections
+	s.deregister(ctx)
+	s.health.stop()
+	if muxServer != nil {
+		s.stopMux(ctx, muxServer)
+	} else {
+		s.grpcServer.GracefulStop()
+	}
+	if closeGateway != nil {
+		closeGateway()
+	}
+	if s.certManager != nil {
+		if err := s.certManager.Close(); err != nil {
+			s.logger.For(ctx).Error("Close certificate manager failed", zap.Error(err))
+		}
+	}
+	s.stopAdmin(ctx)
+}
+
+// register instance of service listening on addr
+func (s *Server) register(ctx context.Context, addr net.Addr) error {
+	if s.registry == nil {
+		return nil
+	}
+	port := 0
+	if s.config.GRPC != nil {
+		port = s.config.GRPC.Port
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		port = tcpAddr.Port
+	}
+	var consul *configs.Consul
+	if s.config.Registry != nil {
+		consul = s.config.Registry.Consul
+	}
+	instance, err := registry.NewInstance(consul, s.config.ServiceName, port)
+	if err != nil {
+		return err
+	}
+	if err := s.registry.Register(ctx, instance); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.instance = instance
+	s.mu.Unlock()
+	s.logger.For(ctx).Info("Registered service instance", zap.String("id", instance.ID), zap.String("address", instance.Address))
+	return nil
+}
+
+func (s *Server) deregister(ctx context.Context) {
+	s.mu.Lock()
+	instance := s.instance
+	s.instance = nil
+	s.mu.Unlock()
+	if instance == nil {
+		return
+	}
+	if err := s.registry.Deregister(ctx, instance); err != nil {
+		s.logger.For(ctx).Error("Deregister service instance failed", zap.String("id", instance.ID), zap.Error(err))
+		return
+	}
+	s.logger.For(ctx).Info("Deregistered service instance", zap.String("id", instance.ID))
+}
@@ -0,0 +1,200 @@
+// Package servertest boots services in-process on a bufconn listener
+// w the same server (interceptors, health, error mapping) as production
+package servertest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/proxy"
+	"github.com/1412335/grpc-rest-microservice/pkg/server"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	defaultBufSize = 1024 * 1024
+	readyTimeout   = 5 * time.Second
+	// resolved by the custom dialer, never by dns
+	bufnetTarget = "passthrough:///bufnet"
+)
+
+type Option func(*options)
+
+type options struct {
+	bufSize         int
+	serverOptions   []server.Option
+	gatewayHandlers []proxy.RegisterServiceHandler
+	dialOptions     []grpc.DialOption
+}
+
+// WithServerOptions passes options (interceptors, health checks...) to server.NewServer
+func WithServerOptions(opts ...server.Option) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// WithGateway serves grpc-gateway handlers on an httptest server (pkg/proxy router)
+func WithGateway(handlers ...proxy.RegisterServiceHandler) Option {
+	return func(o *options) {
+		o.gatewayHandlers = append(o.gatewayHandlers, handlers...)
+	}
+}
+
+// WithDialOptions appends options used to dial Conn, eg. client interceptors
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// WithBufferSize sets bufconn buffer size (default 1MB)
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		o.bufSize = size
+	}
+}
+
+// Server is a running in-process service
+type Server struct {
+	// Conn is a ready client connection to the grpc server
+	Conn *grpc.ClientConn
+	// Gateway serves the grpc-gateway routes, nil w/o WithGateway
+	Gateway *httptest.Server
+
+	server       *server.Server
+	listener     *bufconn.Listener
+	closeGateway context.CancelFunc
+	done         chan error
+}
+
+// New registers services on a grpc server built from config & starts serving on a bufconn listener
+// TLS, admin server, multiplexing & config registry are disabled: everything stays in memory
+// instances are registered only w server.WithRegistry, eg. registry.NewMemoryRegistry
+func New(config *configs.ServiceConfig, registerService func(*grpc.Server) error, opt ...Option) (*Server, error) {
+	o := &options{bufSize: defaultBufSize}
+	for _, f := range opt {
+		f(o)
+	}
+
+	cfg := *config
+	cfg.EnableTLS = false
+	cfg.EnableMultiplex = false
+	cfg.Admin = nil
+	cfg.Registry = nil
+	if cfg.GRPC == nil {
+		cfg.GRPC = &configs.GRPC{}
+	}
+
+	srv := server.NewServer(&cfg, o.serverOptions...)
+	if srv == nil {
+		return nil, errors.New("servertest: create server failed")
+	}
+
+	s := &Server{
+		server:   srv,
+		listener: bufconn.Listen(o.bufSize),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		s.done <- srv.Serve(s.listener, registerService)
+	}()
+
+	conn, err := s.Dial(context.Background(), o.dialOptions...)
+	if err != nil {
+		_ = s.stop()
+		return nil, err
+	}
+	s.Conn = conn
+	if err := s.waitForReady(); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	if len(o.gatewayHandlers) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		handler, err := proxy.NewHandler(&cfg, log.With(), o.gatewayHandlers,
+			proxy.WithEndpoint(bufnetTarget),
+			proxy.WithDialOptions(grpc.WithContextDialer(s.dialer)),
+		).HTTPHandler(ctx)
+		if err != nil {
+			cancel()
+			_ = s.Close()
+			return nil, err
+		}
+		s.closeGateway = cancel
+		s.Gateway = httptest.NewServer(handler)
+	}
+
+	return s, nil
+}
+
+// wait until services are registered & grpc server accepts connections
+func (s *Server) waitForReady() error {
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := healthpb.NewHealthClient(s.Conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		ready <- err
+	}()
+	select {
+	case err := <-s.done:
+		// serve failed (eg. register service error): keep it for stop
+		s.done <- err
+		if err == nil {
+			err = errors.New("servertest: server stopped")
+		}
+		return err
+	case err := <-ready:
+		return err
+	}
+}
+
+func (s *Server) dialer(context.Context, string) (net.Conn, error) {
+	return s.listener.Dial()
+}
+
+// Dial opens another client connection to the grpc server
+func (s *Server) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(s.dialer),
+	}, opts...)
+	return grpc.DialContext(ctx, bufnetTarget, opts...)
+}
+
+// Close stops gateway, client connection & grpc server
+func (s *Server) Close() error {
+	if s.Gateway != nil {
+		s.Gateway.Close()
+	}
+	if s.closeGateway != nil {
+		s.closeGateway()
+	}
+	var err error
+	if s.Conn != nil {
+		err = s.Conn.Close()
+	}
+	if serveErr := s.stop(); err == nil {
+		err = serveErr
+	}
+	return err
+}
+
+func (s *Server) stop() error {
+	s.server.Stop()
+	err := <-s.done
+	if err == grpc.ErrServerStopped {
+		return nil
+	}
+	return err
+}
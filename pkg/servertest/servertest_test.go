@@ -0,0 +1,206 @@
+package servertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	pkgErrors "github.com/1412335/grpc-rest-microservice/pkg/errors"
+	"github.com/1412335/grpc-rest-microservice/pkg/registry"
+	"github.com/1412335/grpc-rest-microservice/pkg/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type userService struct {
+	api_v3.UnimplementedUserServiceServer
+}
+
+func (*userService) Login(ctx context.Context, req *api_v3.LoginRequest) (*api_v3.LoginResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, pkgErrors.BadRequest("invalid login", map[string]string{"email": "required"})
+	}
+	return &api_v3.LoginResponse{Token: "token"}, nil
+}
+
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	s, err := New(&configs.ServiceConfig{ServiceName: "test", Version: "v3"}, func(srv *grpc.Server) error {
+		api_v3.RegisterUserServiceServer(srv, &userService{})
+		return nil
+	}, opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+	return s
+}
+
+func TestNew(t *testing.T) {
+	s := newTestServer(t)
+	if s.Gateway != nil {
+		t.Errorf("Gateway = %v, want nil w/o WithGateway", s.Gateway)
+	}
+
+	rsp, err := healthpb.NewHealthClient(s.Conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "api_v3.UserService"})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, want SERVING", rsp.GetStatus())
+	}
+
+	client := api_v3.NewUserServiceClient(s.Conn)
+	login, err := client.Login(context.Background(), &api_v3.LoginRequest{Email: "a@b.c"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if login.GetToken() != "token" {
+		t.Errorf("Login() token = %q, want %q", login.GetToken(), "token")
+	}
+
+	_, err = client.Login(context.Background(), &api_v3.LoginRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Login() code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestNew_RegisterError(t *testing.T) {
+	wantErr := errors.New("register failed")
+	s, err := New(&configs.ServiceConfig{ServiceName: "test"}, func(*grpc.Server) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("New() error = %v, want %v", err, wantErr)
+	}
+	if s != nil {
+		t.Errorf("New() = %v, want nil", s)
+	}
+}
+
+func TestNew_Registry(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	s, err := New(&configs.ServiceConfig{ServiceName: "test", GRPC: &configs.GRPC{Port: 9090}}, func(srv *grpc.Server) error {
+		api_v3.RegisterUserServiceServer(srv, &userService{})
+		return nil
+	}, WithServerOptions(server.WithRegistry(r)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// registered while serving
+	instances, _ := r.Resolve(context.Background(), "test")
+	if len(instances) != 1 || !strings.HasSuffix(instances[0].Address, ":9090") {
+		t.Errorf("Resolve() = %+v, want an instance on port 9090", instances)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if instances, _ = r.Resolve(context.Background(), "test"); len(instances) != 0 {
+		t.Errorf("Resolve() after Close = %+v, want empty", instances)
+	}
+}
+
+func TestNew_ConfigRegistry(t *testing.T) {
+	// consul agent of a real config.yml
+	var registered int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&registered, 1)
+	}))
+	defer agent.Close()
+
+	config := &configs.ServiceConfig{ServiceName: "test", Registry: &configs.Registry{
+		Backend: "consul",
+		Consul:  &configs.Consul{AddressConsul: agent.Listener.Addr().String()},
+	}}
+	s, err := New(config, func(srv *grpc.Server) error {
+		api_v3.RegisterUserServiceServer(srv, &userService{})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&registered); n != 0 {
+		t.Errorf("consul requests = %d, want 0", n)
+	}
+}
+
+func TestNew_Gateway(t *testing.T) {
+	s := newTestServer(t, WithGateway(api_v3.RegisterUserServiceHandlerFromEndpoint))
+	if s.Gateway == nil {
+		t.Fatal("Gateway = nil")
+	}
+
+	// health of the in-memory grpc server
+	rsp, err := http.Get(s.Gateway.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("Get(/readyz) error = %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("Get(/readyz) status = %d, want %d", rsp.StatusCode, http.StatusOK)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantData   map[string]string
+	}{
+		{
+			name:       "ok",
+			body:       `{"email":"a@b.c","password":"x"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad request",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantData:   map[string]string{"email": "required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp, err := http.Post(s.Gateway.URL+"/api/v3/users/login", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Post() error = %v", err)
+			}
+			defer rsp.Body.Close()
+			if rsp.StatusCode != tt.wantStatus {
+				t.Errorf("Post() status = %d, want %d", rsp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantData == nil {
+				return
+			}
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			for k, v := range tt.wantData {
+				if body.Data[k] != v {
+					t.Errorf("Post() data[%s] = %q, want %q", k, body.Data[k], v)
+				}
+			}
+		})
+	}
+}
@@ -26,6 +26,10 @@ func (t *TraceServerMux) SetTracer(tracer opentracing.Tracer) {
 }
 
 func (t *TraceServerMux) Middleware(handler http.Handler) http.Handler {
+	// tracer not initialized (eg. tracing disabled)
+	if t.tracer == nil {
+		return handler
+	}
 	middleware := nethttp.Middleware(
 		t.tracer,
 		handler,
@@ -52,6 +56,9 @@ func (t *TraceServerMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // inject spanCtx metadata into runtime server mux
 func WithMetadata(ctx context.Context, r *http.Request) metadata.MD {
 	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
 	spanCtx := span.Context()
 	carrier := make(map[string]string)
 	if err := span.Tracer().Inject(
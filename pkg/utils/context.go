@@ -18,3 +18,6 @@ func GetContextValue(ctx context.Context, key string) (string, bool) {
 func SetContextValue(ctx context.Context, key string, value interface{}) context.Context {
 	return context.WithValue(ctx, contextKey(key), value)
 }
+
+// context key of the authenticated user id (jwt claims) set by auth interceptors
+const UserIDContextKey = "userClaims.ID"
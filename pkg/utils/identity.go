@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity of a peer authenticated w a verified client certificate (mTLS)
+type Identity struct {
+	CommonName string
+	DNSNames   []string
+	URIs       []string
+	Emails     []string
+}
+
+// Name returns URI SAN (eg. spiffe id), DNS SAN or subject common name
+func (i *Identity) Name() string {
+	if len(i.URIs) > 0 {
+		return i.URIs[0]
+	}
+	if len(i.DNSNames) > 0 {
+		return i.DNSNames[0]
+	}
+	return i.CommonName
+}
+
+// PeerIdentity gets identity of the verified client certificate of grpc peer
+func PeerIdentity(ctx context.Context) (*Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	identity := &Identity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity, true
+}
@@ -43,3 +43,68 @@ func LoadServerTLSConfig(certPem, keyPem string) (*tls.Config, error) {
 	}
 	return config, nil
 }
+
+// client certificate auth modes of server
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// LoadClientTLSConfigWithCert presents client certificate (mTLS) if certPem & keyPem are set
+func LoadClientTLSConfigWithCert(caCert, certPem, keyPem string) (*tls.Config, error) {
+	config, err := LoadClientTLSConfig(caCert)
+	if err != nil {
+		return nil, err
+	}
+	if certPem == "" || keyPem == "" {
+		return config, nil
+	}
+	clientCert, err := tls.LoadX509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{clientCert}
+	return config, nil
+}
+
+// ParseClientAuth maps a client auth mode to its tls type, none if empty
+func ParseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		// verify client certificate if given
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid client auth mode: %s", clientAuth)
+	}
+}
+
+// LoadServerTLSConfigWithClientAuth requests &/or requires client certificates signed by caCert
+func LoadServerTLSConfigWithClientAuth(certPem, keyPem, caCert, clientAuth string) (*tls.Config, error) {
+	config, err := LoadServerTLSConfig(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	if config.ClientAuth, err = ParseClientAuth(clientAuth); err != nil {
+		return nil, err
+	}
+	if config.ClientAuth == tls.NoClientCert {
+		return config, nil
+	}
+
+	// Load certificate of the CA who signed client's certificate
+	pemClientCA, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemClientCA) {
+		return nil, fmt.Errorf("failed to add client CA's certificate")
+	}
+	config.ClientCAs = certPool
+	return config, nil
+}
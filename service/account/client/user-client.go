@@ -33,7 +33,17 @@ type userClientImpl struct {
 	userSrvClient api_v3.UserServiceClient
 }
 
+// default deadline of user service calls when no call policy is configured
+var defaultMethods = []*configs.MethodConfig{
+	{Name: []string{"*"}, Timeout: 5 * time.Second},
+}
+
 func NewUserServiceClient(cfgs *configs.ClientConfig, opt ...grpcClient.Option) (UserClient, error) {
+	if len(cfgs.Methods) == 0 {
+		c := *cfgs
+		c.Methods = defaultMethods
+		cfgs = &c
+	}
 	opt = append(opt,
 		grpcClient.WithInterceptors(interceptor.NewSimpleClientInterceptor()),
 	)
@@ -58,15 +68,9 @@ func (c *userClientImpl) setHeader(ctx context.Context, m map[string]string) con
 	return metadata.NewOutgoingContext(ctx, md)
 }
 
-func (c *userClientImpl) timeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(ctx, 5*time.Second)
-}
-
 // login & get token
 func (c *userClientImpl) Login(ctx context.Context, email, password string) (string, error) {
 	ctx = c.setHeader(ctx, map[string]string{"custom-req-header": "login"})
-	ctx, cancel := c.timeoutContext(ctx)
-	defer cancel()
 	// prepare request
 	msg := &api_v3.LoginRequest{
 		Email:    email,
@@ -91,8 +95,6 @@ func (c *userClientImpl) Login(ctx context.Context, email, password string) (str
 
 // validate token
 func (c *userClientImpl) Validate(ctx context.Context, token string) (*User, error) {
-	ctx, cancel := c.timeoutContext(ctx)
-	defer cancel()
 	// prepare request
 	msg := &api_v3.ValidateRequest{
 		Token: token,
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"errors"
+
 	handlerSrv "account/handler"
+	"account/migrations"
 	serverSrv "account/server"
 
 	"github.com/1412335/grpc-rest-microservice/cmd"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	pkgServer "github.com/1412335/grpc-rest-microservice/pkg/server"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -22,7 +26,7 @@ var command = &cobra.Command{
 
 func init() {
 	log.Info("account.Init")
-	cmd.AddCommand(command)
+	cmd.AddCommand(command, cmd.NewMigrateCommand(migrations.FS, "migrations"))
 }
 
 func Execute() {
@@ -38,6 +42,24 @@ func RunService() error {
 	// set default logger
 	// log.DefaultLogger = zapLogger
 
+	// grpc + gateway on a single port
+	if cfgs.EnableMultiplex {
+		server := serverSrv.NewServer(
+			cfgs,
+			pkgServer.WithGateway(handlerSrv.NewHandler(cfgs)),
+		)
+		if server == nil {
+			err := errors.New("create server failed")
+			zapLogger.Bg().Error("server run failed", zap.Error(err))
+			return err
+		}
+		if err := server.Run(); err != nil {
+			zapLogger.Bg().Error("server run failed", zap.Error(err))
+			return err
+		}
+		return nil
+	}
+
 	// run grpc server
 	go func() {
 		// server
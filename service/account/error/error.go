@@ -1,6 +1,10 @@
 package error
 
-import "github.com/1412335/grpc-rest-microservice/pkg/errors"
+import (
+	"time"
+
+	"github.com/1412335/grpc-rest-microservice/pkg/errors"
+)
 
 var (
 	ErrMissingUserID = errors.BadRequest("Missing user id", map[string]string{"id": "Missing user id"})
@@ -22,6 +26,7 @@ var (
 	ErrUpdateAccountID       = errors.BadRequest("cannot update id", map[string]string{"update_mask": "cannot update id field"})
 	ErrUpdateAccountUserID   = errors.BadRequest("cannot update user_id", map[string]string{"update_mask": "cannot update user_id field"})
 	ErrUpdateAccountBank     = errors.BadRequest("cannot update bank", map[string]string{"update_mask": "cannot update bank field"})
+	ErrAccountBusy           = errors.ResourceExhausted("Account busy w other transactions", time.Second)
 
 	ErrMissingTransactionID             = errors.BadRequest("Missing transaction id", map[string]string{"id": "Missing transaction id"})
 	ErrInvalidTransactionAmount         = errors.BadRequest("Invalid Transaction amount (>0)", map[string]string{"amount": "greater than zero"})
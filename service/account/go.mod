@@ -1,6 +1,6 @@
 module account
 
-go 1.15
+go 1.16
 
 require (
 	github.com/1412335/grpc-rest-microservice v0.0.0-20210521082415-f63016809216
@@ -47,3 +47,5 @@ require (
 	gorm.io/driver/postgres v1.1.0 // indirect
 	gorm.io/gorm v1.21.10
 )
+
+replace github.com/1412335/grpc-rest-microservice => ../..
@@ -0,0 +1,21 @@
+-- if not exists: adopts schemas created by gorm AutoMigrate
+CREATE TABLE IF NOT EXISTS accounts (
+	id text NOT NULL,
+	user_id text,
+	name text,
+	bank text,
+	balance decimal,
+	created_at timestamptz,
+	updated_at timestamptz,
+	PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS transactions (
+	id text NOT NULL,
+	account_id text,
+	amount decimal,
+	transaction_type text,
+	created_at timestamptz,
+	updated_at timestamptz,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_accounts_transactions FOREIGN KEY (account_id) REFERENCES accounts (id)
+);
@@ -0,0 +1,2 @@
+-- fencing token of balance updates under the account lock
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS lock_token bigint NOT NULL DEFAULT 0;
@@ -1,13 +1,13 @@
 package model
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"time"
 
 	pb "account/api"
 
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 
 	"github.com/microcosm-cc/bluemonday"
@@ -22,6 +22,7 @@ type Account struct {
 	Name         string         `json:"name" validate:"max=100"`
 	Bank         string         `json:"bank" validate:"nonzero"`
 	Balance      float64        `json:"balance" validate:"min=0"`
+	LockToken    int64          `json:"-" gorm:"not null;default:0"` // fencing token of the last locked balance update
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	Transactions []*Transaction `json:"transactions"`
@@ -49,30 +50,43 @@ func (a *Account) UpdateFromGRPC(acc *pb.Account) {
 	a.Balance = acc.GetBalance()
 }
 
-func (a *Account) genCacheKey() string {
-	return a.UserID + "_" + a.ID
+// cache tags: entries of a user or an account are invalidated together
+func UserTag(userID string) string {
+	return "user:" + userID
 }
 
-func (a *Account) GetCache() error {
-	var bytes []byte
-	if err := cache.Get(a.genCacheKey(), &bytes); err != nil {
-		return err
-	}
-	if err := json.Unmarshal(bytes, a); err != nil {
-		return err
-	}
-	return nil
+func AccountTag(accountID string) string {
+	return "account:" + accountID
 }
 
-func (a *Account) Cache() error {
-	bytes, err := json.Marshal(a)
-	if err != nil {
-		return err
+// CacheTags implements cache.Tagger: loaded accounts are tagged w their own ids, empty ids skipped
+func (a *Account) CacheTags() []string {
+	tags := make([]string, 0, 2)
+	if a.UserID != "" {
+		tags = append(tags, UserTag(a.UserID))
 	}
-	if err := a.DelCache(); err != nil {
-		return err
+	if a.ID != "" {
+		tags = append(tags, AccountTag(a.ID))
 	}
-	if err := cache.Set(a.genCacheKey(), string(bytes)); err == cache.ErrCacheNotAvailable {
+	return tags
+}
+
+func (a *Account) genCacheKey() string {
+	return a.UserID + "_" + a.ID
+}
+
+func (a *Account) GetCache(ctx context.Context) error {
+	return cache.Get(ctx, a.genCacheKey(), a)
+}
+
+// GetOrLoad gets account from cache or loader, concurrent misses share one load
+// tagged w ids of the loaded account, not of the receiver
+func (a *Account) GetOrLoad(ctx context.Context, loader cache.Loader) error {
+	return cache.GetOrLoad(ctx, a.genCacheKey(), 0, a, loader)
+}
+
+func (a *Account) Cache(ctx context.Context) error {
+	if err := cache.Set(ctx, a.genCacheKey(), a, 0, a.CacheTags()...); err == cache.ErrCacheNotAvailable {
 		return nil
 	} else if err != nil {
 		return err
@@ -80,8 +94,14 @@ func (a *Account) Cache() error {
 	return nil
 }
 
-func (a *Account) DelCache() error {
-	if err := cache.Delete(a.genCacheKey()); err == cache.ErrCacheNotAvailable {
+// DelCache removes account & its transactions
+func (a *Account) DelCache(ctx context.Context) error {
+	if err := cache.Delete(ctx, a.genCacheKey()); err == cache.ErrCacheNotAvailable {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := cache.InvalidateTag(ctx, AccountTag(a.ID)); err == cache.ErrCacheNotAvailable {
 		return nil
 	} else if err != nil {
 		return err
@@ -125,7 +145,7 @@ func (a *Account) BeforeCreate(tx *gorm.DB) error {
 
 func (a *Account) AfterCreate(tx *gorm.DB) error {
 	// cache user
-	if err := a.Cache(); err != nil {
+	if err := a.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -143,7 +163,7 @@ func (a *Account) BeforeUpdate(tx *gorm.DB) error {
 // Updating data in same transaction
 func (a *Account) AfterUpdate(tx *gorm.DB) error {
 	// cache user
-	if err := a.Cache(); err != nil {
+	if err := a.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -155,7 +175,7 @@ func (a *Account) BeforeDelete(tx *gorm.DB) error {
 
 func (a *Account) AfterDelete(tx *gorm.DB) error {
 	// rm cache user
-	if err := a.DelCache(); err != nil {
+	if err := a.DelCache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -1,12 +1,12 @@
 package model
 
 import (
-	"encoding/json"
+	"context"
 	"time"
 
 	pb "account/api"
 
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -49,22 +49,34 @@ func (a *Transaction) genCacheKey() string {
 	return a.AccountID + "_" + a.ID
 }
 
-func (a *Transaction) GetCache() error {
-	var bytes []byte
-	if err := cache.Get(a.genCacheKey(), &bytes); err != nil {
-		return err
-	}
-	if err := json.Unmarshal(bytes, a); err != nil {
-		return err
+func (a *Transaction) GetCache(ctx context.Context) error {
+	return cache.Get(ctx, a.genCacheKey(), a)
+}
+
+// tagged w account & owner, owner is known once account is loaded
+func (a *Transaction) cacheTags() []string {
+	tags := []string{AccountTag(a.AccountID)}
+	if a.Account.UserID != "" {
+		tags = append(tags, UserTag(a.Account.UserID))
 	}
-	return nil
+	return tags
 }
 
-func (a *Transaction) Cache() error {
+func (a *Transaction) Cache(ctx context.Context) error {
+	if err := cache.Set(ctx, a.genCacheKey(), a, 0, a.cacheTags()...); err == cache.ErrCacheNotAvailable {
+		return nil
+	} else if err != nil {
+		return err
+	}
 	return nil
 }
 
-func (a *Transaction) DelCache() error {
+func (a *Transaction) DelCache(ctx context.Context) error {
+	if err := cache.Delete(ctx, a.genCacheKey()); err == cache.ErrCacheNotAvailable {
+		return nil
+	} else if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -99,7 +111,7 @@ func (a *Transaction) BeforeCreate(tx *gorm.DB) error {
 
 func (a *Transaction) AfterCreate(tx *gorm.DB) error {
 	// cache user
-	if err := a.Cache(); err != nil {
+	if err := a.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -114,7 +126,7 @@ func (a *Transaction) BeforeUpdate(tx *gorm.DB) error {
 // Updating data in same transaction
 func (a *Transaction) AfterUpdate(tx *gorm.DB) error {
 	// cache user
-	if err := a.Cache(); err != nil {
+	if err := a.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -126,7 +138,7 @@ func (a *Transaction) BeforeDelete(tx *gorm.DB) error {
 
 func (a *Transaction) AfterDelete(tx *gorm.DB) error {
 	// rm cache user
-	if err := a.DelCache(); err != nil {
+	if err := a.DelCache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -9,7 +9,10 @@ import (
 	errorSrv "account/error"
 	"account/model"
 
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
 	"github.com/1412335/grpc-rest-microservice/pkg/utils"
@@ -19,45 +22,95 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// balance updates of an account wait for the lock up to request deadline
+const (
+	accountLockTTL   = 5 * time.Second
+	accountLockRetry = 20 * time.Millisecond
 )
 
 type accountServiceImpl struct {
-	dal    *postgres.DataAccessLayer
+	dal    dal.DataAccessLayer
 	logger log.Factory
+	// serializes balance updates across replicas, optional
+	locker *redis.Redis
 }
 
 var _ pb.AccountServiceServer = (*accountServiceImpl)(nil)
 
-func NewAccountService(dal *postgres.DataAccessLayer) pb.AccountServiceServer {
+func NewAccountService(dal dal.DataAccessLayer, locker *redis.Redis) pb.AccountServiceServer {
 	return &accountServiceImpl{
 		dal:    dal,
+		locker: locker,
 		logger: log.With(zap.String("srv", "account")),
 	}
 }
 
-// get user by id from redis & db
+// get account by id from cache or db, concurrent misses share one query
 func (u *accountServiceImpl) getAccountByID(ctx context.Context, account *model.Account) error {
 	logger := u.logger.With(zap.String("id", account.ID), zap.String("userId", account.UserID)).For(ctx)
-	// get from cache
-	if e := account.GetCache(); e != nil {
-		logger.Error("Get account cache", zap.Error(e))
-	} else {
-		return nil
-	}
-	return u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// find user by id
-		if e := tx.First(account).Error; e == gorm.ErrRecordNotFound {
-			return errorSrv.ErrAccountNotFound
+	err := account.GetOrLoad(ctx, func(ctx context.Context) (interface{}, error) {
+		acc := &model.Account{ID: account.ID, UserID: account.UserID}
+		// primary: lagging replica would be cached until ttl
+		if e := u.dal.GetDatabase().WithContext(postgres.WithPrimary(ctx)).First(acc).Error; e == gorm.ErrRecordNotFound {
+			return nil, cache.ErrNotFound
 		} else if e != nil {
 			logger.Error("Lookup account", zap.Error(e))
-			return errorSrv.ErrConnectDB
+			return nil, errorSrv.ErrConnectDB
 		}
-		// cache
-		if e := account.Cache(); e != nil {
-			logger.Error("Cache account", zap.Error(e))
-		}
-		return nil
+		return acc, nil
 	})
+	if err == cache.ErrNotFound {
+		return errorSrv.ErrAccountNotFound
+	}
+	return err
+}
+
+// lockAccount runs fn holding the account lock w its fencing token, directly w token 0 w/o redis
+func (u *accountServiceImpl) lockAccount(ctx context.Context, accountID string, fn func(ctx context.Context, token int64) error) error {
+	if u.locker == nil {
+		return fn(ctx, 0)
+	}
+	err := u.locker.WithLock(ctx, "account:"+accountID, func(ctx context.Context, l *redis.Lock) error {
+		return fn(ctx, l.Token())
+	}, redis.LockTTL(accountLockTTL), redis.LockRetry(accountLockRetry))
+	if err == redis.ErrLockNotObtained {
+		return errorSrv.ErrAccountBusy
+	}
+	return err
+}
+
+// lookupAccount reads & locks account row in tx: cached balance may be stale
+func (u *accountServiceImpl) lookupAccount(ctx context.Context, tx *gorm.DB, account *model.Account) error {
+	if e := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(account).First(account).Error; e == gorm.ErrRecordNotFound {
+		return errorSrv.ErrAccountNotFound
+	} else if e != nil {
+		u.logger.For(ctx).Error("Lookup account", zap.Error(e))
+		return errorSrv.ErrConnectDB
+	}
+	return nil
+}
+
+// saveBalance updates account balance, w token rejects holders of an expired lock
+func (u *accountServiceImpl) saveBalance(ctx context.Context, tx *gorm.DB, account *model.Account, token int64) error {
+	values := map[string]interface{}{"balance": account.Balance}
+	psql := tx.Model(account)
+	if token > 0 {
+		values["lock_token"] = token
+		psql = psql.Where("lock_token <= ?", token)
+	}
+	res := psql.Updates(values)
+	if res.Error != nil {
+		u.logger.For(ctx).Error("Update account balance", zap.Any("data", account), zap.Error(res.Error))
+		return errorSrv.ErrConnectDB
+	}
+	if res.RowsAffected == 0 {
+		u.logger.For(ctx).Error("Update account balance w stale lock", zap.String("id", account.ID), zap.Int64("token", token))
+		return errorSrv.ErrAccountBusy
+	}
+	return nil
 }
 
 // build query statement & get list users
@@ -195,57 +248,80 @@ func (u *accountServiceImpl) Update(ctx context.Context, req *pb.UpdateAccountRe
 	if req.GetAccount().GetId() == "" {
 		return nil, errorSrv.ErrMissingAccountID
 	}
-	account := &model.Account{
-		UserID: req.GetAccount().GetUserId(),
-		ID:     req.GetAccount().GetId(),
+	u.logger.For(ctx).Info("mask", zap.Strings("path", req.GetUpdateMask().GetPaths()))
+	// If there is no update mask do a regular update
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "balance"}
 	}
-	rsp := &pb.UpdateAccountResponse{}
-	err := u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// find user by id
-		if e := u.getAccountByID(tx.Statement.Context, account); e != nil {
-			return e
+	updateName, updateBalance := false, false
+	for _, path := range paths {
+		switch path {
+		case "id":
+			return nil, errorSrv.ErrUpdateAccountID
+		case "user_id":
+			return nil, errorSrv.ErrUpdateAccountUserID
+		case "bank":
+			return nil, errorSrv.ErrUpdateAccountBank
+		case "name":
+			updateName = true
+		case "balance":
+			updateBalance = true
+		default:
+			return nil, errors.BadRequest("invalid field specified", map[string]string{
+				"update_mask": fmt.Sprintf("account does not have field %q", path),
+			})
 		}
-		u.logger.For(ctx).Info("mask", zap.Strings("path", req.GetUpdateMask().GetPaths()))
-		// If there is no update mask do a regular update
-		if req.GetUpdateMask() == nil || len(req.GetUpdateMask().GetPaths()) == 0 {
-			account.UpdateFromGRPC(req.GetAccount())
-		} else {
-			for _, path := range req.GetUpdateMask().GetPaths() {
+	}
+
+	rsp := &pb.UpdateAccountResponse{}
+	update := func(ctx context.Context, token int64) error {
+		return u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// find account in tx: cached balance may be stale
+			account := &model.Account{ID: req.GetAccount().GetId()}
+			if e := u.lookupAccount(ctx, tx, account); e != nil {
+				return e
+			}
+			for _, path := range paths {
 				switch path {
-				case "id":
-					return errorSrv.ErrUpdateAccountID
-				case "user_id":
-					return errorSrv.ErrUpdateAccountUserID
-				case "bank":
-					return errorSrv.ErrUpdateAccountBank
 				case "name":
 					account.Name = req.GetAccount().GetName()
 				case "balance":
 					account.Balance = req.GetAccount().GetBalance()
-				default:
-					return errors.BadRequest("invalid field specified", map[string]string{
-						"update_mask": fmt.Sprintf("account does not have field %q", path),
-					})
 				}
 			}
-		}
-		if err := account.Validate(); err != nil {
-			u.logger.For(ctx).Error("Validate account", zap.Error(err))
-			return err
-		}
-		if err := tx.Save(account).Error; err != nil {
-			u.logger.For(ctx).Error("Update account", zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		// response
-		rsp.Account = account.Transform2GRPC()
-		rsp.Account.UpdatedAt = timestamppb.New(account.UpdatedAt)
-		return nil
-	})
+			if err := account.Validate(); err != nil {
+				u.logger.For(ctx).Error("Validate account", zap.Error(err))
+				return err
+			}
+			// write masked fields only: balance is written under the account lock
+			if updateName {
+				if err := tx.Model(account).Select("Name").Updates(account).Error; err != nil {
+					u.logger.For(ctx).Error("Update account", zap.Error(err))
+					return errorSrv.ErrConnectDB
+				}
+			}
+			if updateBalance {
+				if err := u.saveBalance(ctx, tx, account, token); err != nil {
+					return err
+				}
+			}
+			// response
+			rsp.Account = account.Transform2GRPC()
+			rsp.Account.UpdatedAt = timestamppb.New(account.UpdatedAt)
+			return nil
+		})
+	}
+	var err error
+	if updateBalance {
+		err = u.lockAccount(ctx, req.GetAccount().GetId(), update)
+	} else {
+		err = update(ctx, 0)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return rsp, err
+	return rsp, nil
 }
 
 func (u *accountServiceImpl) List(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsResponse, error) {
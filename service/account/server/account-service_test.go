@@ -13,7 +13,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
@@ -73,7 +73,7 @@ func initCache(t *testing.T) {
 		require.NotNil(t, redisStore)
 		RedisStore = redisStore
 		// cache w redis store
-		cache.DefaultCache, err = cache.NewRedisCache(redisStore, cache.WithPrefix(cachePrefix))
+		cache.DefaultCache, err = cache.NewCache(cache.NewRedisStore(redisStore), cache.WithPrefix(cachePrefix))
 		require.NoError(t, err)
 		require.NotNil(t, cache.DefaultCache)
 	}
@@ -156,7 +156,7 @@ func TestNewAccountService(t *testing.T) {
 			dal := tt.caller(t)
 			if !tt.wantErr {
 				require.NotNil(t, dal)
-				u := NewAccountService(dal)
+				u := NewAccountService(dal, nil)
 				require.NotNil(t, u)
 			} else {
 				require.Nil(t, dal)
@@ -182,7 +182,7 @@ func Test_accountServiceImpl_getAccountByID(t *testing.T) {
 		ID:     accountRsp.Account.Id,
 		UserID: accountRsp.Account.UserId,
 	}
-	err = acc.GetCache()
+	err = acc.GetCache(context.TODO())
 	require.NoError(t, err)
 	if !reflect.DeepEqual(acc.Transform2GRPC(), accountRsp.Account) {
 		t.Errorf("account.GetCache() = %v, want %v", acc.Transform2GRPC(), accountRsp.Account)
@@ -516,7 +516,7 @@ func Test_accountServiceImpl_Create(t *testing.T) {
 					ID:     got.Account.Id,
 					UserID: got.Account.UserId,
 				}
-				err = acc.GetCache()
+				err = acc.GetCache(context.TODO())
 				require.NoError(t, err)
 				if !reflect.DeepEqual(acc.Transform2GRPC(), got.Account) {
 					t.Errorf("account.GetCache() = %v, want %v", acc.Transform2GRPC(), got.Account)
@@ -586,8 +586,9 @@ func Test_accountServiceImpl_Delete(t *testing.T) {
 					ID:     accountRsp.Account.Id,
 					UserID: accountRsp.Account.UserId,
 				}
-				err = acc.GetCache()
-				require.Equal(t, err.Error(), "cache: key is missing")
+				// not found cached by lookup above
+				err = acc.GetCache(context.TODO())
+				require.ErrorIs(t, err, cache.ErrNotFound)
 			}
 		})
 	}
@@ -803,7 +804,7 @@ func Test_accountServiceImpl_Update(t *testing.T) {
 				}
 				// v, err := RedisStore.GetClient().Get(context.TODO(), "account-service-cache-testing"+acc.UserID+"_"+acc.ID).Result()
 				// fmt.Printf("%v", v)
-				err = acc.GetCache()
+				err = acc.GetCache(context.TODO())
 				require.NoError(t, err)
 				accpb := acc.Transform2GRPC()
 				accpb.UpdatedAt = timestamppb.New(acc.UpdatedAt)
@@ -1051,3 +1052,50 @@ func Test_accountServiceImpl_ListStream(t *testing.T) {
 		})
 	}
 }
+
+func Test_accountServiceImpl_saveBalance(t *testing.T) {
+	store := newTestStore(t)
+	db := store.GetDatabase()
+	srv := NewAccountService(store, nil).(*accountServiceImpl)
+	ctx := context.Background()
+	account := &model.Account{ID: "a", UserID: "u", Bank: "ACB", Balance: 10}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   int64
+		balance float64
+		wantErr error
+	}{
+		{name: "locked", token: 5, balance: 20},
+		{name: "same lock", token: 5, balance: 30},
+		{name: "expired lock", token: 3, balance: 40, wantErr: errorSrv.ErrAccountBusy},
+		{name: "w/o lock", balance: 50},
+		{name: "next lock", token: 6, balance: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := &model.Account{ID: "a"}
+			if err := db.First(before).Error; err != nil {
+				t.Fatal(err)
+			}
+			acc := &model.Account{ID: "a", Balance: tt.balance}
+			if err := srv.saveBalance(ctx, db, acc, tt.token); err != tt.wantErr {
+				t.Errorf("saveBalance() error = %v, want %v", err, tt.wantErr)
+			}
+			got := &model.Account{ID: "a"}
+			if err := db.First(got).Error; err != nil {
+				t.Fatal(err)
+			}
+			want := tt.balance
+			if tt.wantErr != nil {
+				want = before.Balance
+			}
+			if got.Balance != want {
+				t.Errorf("balance = %v, want %v", got.Balance, want)
+			}
+		})
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"account/client"
 	"account/model"
 
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
-	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
 	"github.com/1412335/grpc-rest-microservice/pkg/server"
@@ -21,36 +21,39 @@ import (
 
 type Server struct {
 	server  *server.Server
-	dal     *postgres.DataAccessLayer
+	dal     dal.DataAccessLayer
+	redis   *redis.Redis
 	userSrv client.UserClient
 }
 
 func NewServer(srvConfig *configs.ServiceConfig, opt ...server.Option) *Server {
-	// init postgres
-	dal, err := postgres.NewDataAccessLayer(context.Background(), srvConfig.Database)
-	if err != nil || dal.GetDatabase() == nil {
+	// init db: postgres, mysql or sqlite
+	store, err := dal.NewDataAccessLayer(context.Background(), srvConfig.Database)
+	if err != nil || store.GetDatabase() == nil {
 		log.Error("init db failed", zap.Error(err))
 		return nil
 	}
-	// migrate db
-	if err = dal.GetDatabase().AutoMigrate(
-		&model.Account{},
-		&model.Transaction{},
-	); err != nil {
-		log.Error("migrate db failed", zap.Error(err))
-		return nil
+	// dev only: schema is migrated by `migrate up`
+	if srvConfig.Database.AutoMigrate {
+		if err = store.GetDatabase().AutoMigrate(
+			&model.Account{},
+			&model.Transaction{},
+		); err != nil {
+			log.Error("migrate db failed", zap.Error(err))
+			return nil
+		}
 	}
 
 	// connect redis
-	redisStore, err := redis.New(redis.WithNodes(srvConfig.Redis.Nodes), redis.WithPrefix(srvConfig.ServiceName))
+	redisStore, err := redis.New(redis.WithConfig(srvConfig.Redis), redis.WithPrefix(srvConfig.ServiceName))
 	if err != nil {
 		log.Error("connect redis store failed", zap.Error(err))
-	} else if redisStore != nil {
-		// cache w redis store
-		cache.DefaultCache, err = cache.NewRedisCache(redisStore, cache.WithPrefix(srvConfig.ServiceName))
-		if err != nil {
-			log.Error("create cache redis store failed", zap.Error(err))
-		}
+	}
+
+	// cache w redis store, in memory or both (tiered)
+	cache.DefaultCache, err = cache.New(srvConfig.Cache, redisStore, cache.WithPrefix(srvConfig.ServiceName))
+	if err != nil {
+		log.Error("create cache failed", zap.Error(err))
 	}
 
 	// tracing
@@ -65,7 +68,8 @@ func NewServer(srvConfig *configs.ServiceConfig, opt ...server.Option) *Server {
 
 	// create server
 	srv := &Server{
-		dal: dal,
+		dal:   store,
+		redis: redisStore,
 	}
 
 	// user service client
@@ -85,6 +89,12 @@ func NewServer(srvConfig *configs.ServiceConfig, opt ...server.Option) *Server {
 	// auth server interceptor
 	authInterceptor := NewAuthServerInterceptor(srv.userSrv, srvConfig.AuthRequiredMethods, srvConfig.AccessibleRoles)
 
+	// health probes for dependencies
+	opt = append(opt, server.WithHealthCheck("postgres", store.Ping))
+	if redisStore != nil {
+		opt = append(opt, server.WithHealthCheck("redis", redisStore.Ping))
+	}
+
 	// append server options with logger + auth token interceptor
 	opt = append(opt,
 		server.WithInterceptors(
@@ -104,7 +114,7 @@ func (s *Server) Run() error {
 	return s.server.Run(func(srv *grpc.Server) error {
 		log.Info("Register", zap.String("service", "account"))
 		// implement service
-		accountSrv := NewAccountService(s.dal)
+		accountSrv := NewAccountService(s.dal, s.redis)
 		// register impl service
 		pb.RegisterAccountServiceServer(srv, accountSrv)
 
@@ -1,47 +1,344 @@
 package server
 
 import (
-	"reflect"
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	pb "account/api"
+	"account/client"
+	"account/model"
 
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/server"
+	"github.com/1412335/grpc-rest-microservice/pkg/servertest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gorm.io/gorm"
 )
 
-func TestNewServer(t *testing.T) {
-	type args struct {
-		srvConfig *configs.ServiceConfig
-		opt       []server.Option
+// fakeUserClient validates tokens of users
+type fakeUserClient struct {
+	users map[string]*client.User
+}
+
+func (c *fakeUserClient) Login(ctx context.Context, email, password string) (string, error) {
+	return "", status.Error(codes.Unimplemented, "login")
+}
+
+func (c *fakeUserClient) Validate(ctx context.Context, token string) (*client.User, error) {
+	if user, ok := c.users[token]; ok {
+		return user, nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func (c *fakeUserClient) Close() error {
+	return nil
+}
+
+// newTestServer serves account & transaction services on store w/o redis (memory cache)
+func newTestServer(t *testing.T, store dal.DataAccessLayer) *servertest.Server {
+	t.Helper()
+	config := &configs.ServiceConfig{
+		ServiceName: "account",
+		Version:     "v1",
+		AuthRequiredMethods: map[string]bool{
+			"/account.AccountService/Create":     true,
+			"/account.AccountService/List":       true,
+			"/account.AccountService/Update":     true,
+			"/account.TransactionService/Create": true,
+		},
+	}
+	userSrv := &fakeUserClient{users: map[string]*client.User{
+		"user-token": {ID: "7d2d2a53-64a6-4b6c-b59c-2c0b6e26a3c1", Role: "user"},
+	}}
+
+	s, err := servertest.New(config, func(srv *grpc.Server) error {
+		accountSrv := NewAccountService(store, nil)
+		pb.RegisterAccountServiceServer(srv, accountSrv)
+		pb.RegisterTransactionServiceServer(srv, NewTransactionService(store, accountSrv.(*accountServiceImpl)))
+		return nil
+	},
+		servertest.WithServerOptions(server.WithInterceptors(
+			NewAuthServerInterceptor(userSrv, config.AuthRequiredMethods, config.AccessibleRoles),
+		)),
+		servertest.WithGateway(pb.RegisterAccountServiceHandlerFromEndpoint),
+	)
+	if err != nil {
+		t.Fatalf("servertest.New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+// newTestStore migrates account & transaction tables on a sqlite file: wal lets reads run along a writer
+func newTestStore(t *testing.T) dal.DataAccessLayer {
+	t.Helper()
+	store, err := dal.NewDataAccessLayer(context.Background(), &configs.Database{
+		Driver: dal.DriverSQLite,
+		Scheme: filepath.Join(t.TempDir(), "account.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Disconnect(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := store.GetDatabase().AutoMigrate(&model.Account{}, &model.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func withToken(token string) context.Context {
+	md := metadata.Pairs("x-request-id", "test")
+	if token != "" {
+		md.Set("authorization", token)
 	}
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+func TestServer_Auth(t *testing.T) {
+	s := newTestServer(t, newTestStore(t))
+	accounts := pb.NewAccountServiceClient(s.Conn)
+
 	tests := []struct {
-		name string
-		args args
-		want *Server
+		name       string
+		token      string
+		wantCode   codes.Code
+		wantStatus int
 	}{
-		// TODO: Add test cases.
+		{
+			name:       "missing token",
+			wantCode:   codes.InvalidArgument,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid token",
+			token:      "invalid",
+			wantCode:   codes.Unauthenticated,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid token",
+			token:      "user-token",
+			wantCode:   codes.OK,
+			wantStatus: http.StatusCreated,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewServer(tt.args.srvConfig, tt.args.opt...); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("NewServer() = %v, want %v", got, tt.want)
+			// grpc
+			_, err := accounts.Create(withToken(tt.token), &pb.CreateAccountRequest{Name: "grpc", Bank: pb.Bank_ACB, Balance: 10})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("Create() code = %v, want %v", got, tt.wantCode)
+			}
+
+			// gateway
+			req, err := http.NewRequest(http.MethodPost, s.Gateway.URL+"/api/v1/accounts", strings.NewReader(`{"name":"gateway","bank":"ACB","balance":10}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rsp, err := s.Gateway.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+			if rsp.StatusCode != tt.wantStatus {
+				t.Errorf("POST /api/v1/accounts status = %d, want %d", rsp.StatusCode, tt.wantStatus)
 			}
 		})
 	}
 }
 
-func TestServer_Run(t *testing.T) {
+func TestServer_Errors(t *testing.T) {
+	s := newTestServer(t, newTestStore(t))
+	accounts := pb.NewAccountServiceClient(s.Conn)
+	transactions := pb.NewTransactionServiceClient(s.Conn)
+	ctx := withToken("user-token")
+	userID := "7d2d2a53-64a6-4b6c-b59c-2c0b6e26a3c1"
+
+	// user id is taken from the token
+	created, err := accounts.Create(ctx, &pb.CreateAccountRequest{UserId: "other", Name: "main", Bank: pb.Bank_ACB, Balance: 10})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	account := created.GetAccount()
+	if account.GetUserId() != userID {
+		t.Errorf("Create() user id = %v, want token user", account.GetUserId())
+	}
+	list, err := accounts.List(ctx, &pb.ListAccountsRequest{})
+	if err != nil || len(list.GetAccounts()) != 1 {
+		t.Errorf("List() = %v, %v, want 1 account", list, err)
+	}
+
 	tests := []struct {
-		name    string
-		s       *Server
-		wantErr bool
+		name     string
+		call     func() error
+		wantCode codes.Code
 	}{
-		// TODO: Add test cases.
+		{
+			name: "negative balance",
+			call: func() error {
+				_, err := accounts.Create(ctx, &pb.CreateAccountRequest{Bank: pb.Bank_ACB, Balance: -1})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "update unknown account",
+			call: func() error {
+				_, err := accounts.Update(ctx, &pb.UpdateAccountRequest{Account: &pb.Account{Id: "unknown", Name: "renamed"}})
+				return err
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "withdraw over balance",
+			call: func() error {
+				_, err := transactions.Create(ctx, &pb.CreateTransactionRequest{UserId: userID, AccountId: account.GetId(), Amount: 100, TransactionType: pb.TransactionType_WITHDRAW})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "deposit",
+			call: func() error {
+				_, err := transactions.Create(ctx, &pb.CreateTransactionRequest{UserId: userID, AccountId: account.GetId(), Amount: 5, TransactionType: pb.TransactionType_DEPOSIT})
+				return err
+			},
+			wantCode: codes.OK,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.s.Run(); (err != nil) != tt.wantErr {
-				t.Errorf("Server.Run() error = %v, wantErr %v", err, tt.wantErr)
+			if got := status.Code(tt.call()); got != tt.wantCode {
+				t.Errorf("code = %v, want %v", got, tt.wantCode)
 			}
 		})
 	}
+
+	// balance updated by the deposit only
+	list, err = accounts.List(ctx, &pb.ListAccountsRequest{})
+	if err != nil || len(list.GetAccounts()) != 1 || list.GetAccounts()[0].GetBalance() != 15 {
+		t.Errorf("List() after deposit = %v, %v, want balance 15", list, err)
+	}
+
+	// update & delete of a transaction adjust the balance read in tx
+	deposit, err := transactions.Create(ctx, &pb.CreateTransactionRequest{UserId: userID, AccountId: account.GetId(), Amount: 5, TransactionType: pb.TransactionType_DEPOSIT})
+	if err != nil {
+		t.Fatalf("Create() deposit error = %v", err)
+	}
+	id := deposit.GetTransaction().GetId()
+	if _, err := transactions.Update(ctx, &pb.UpdateTransactionRequest{Transaction: &pb.Transaction{Id: id, AccountId: account.GetId(), Amount: 2}}); err != nil {
+		t.Errorf("Update() transaction error = %v", err)
+	}
+	if _, err := transactions.Delete(ctx, &pb.DeleteTransactionRequest{Id: wrapperspb.String(id)}); err != nil {
+		t.Errorf("Delete() transaction error = %v", err)
+	}
+	if _, err := transactions.Delete(ctx, &pb.DeleteTransactionRequest{Id: wrapperspb.String(id)}); status.Code(err) != codes.NotFound {
+		t.Errorf("Delete() deleted transaction error = %v, want %v", err, codes.NotFound)
+	}
+	list, err = accounts.List(ctx, &pb.ListAccountsRequest{})
+	if err != nil || len(list.GetAccounts()) != 1 || list.GetAccounts()[0].GetBalance() != 15 {
+		t.Errorf("List() after update & delete = %v, %v, want balance 15", list, err)
+	}
+
+	// gateway maps not found
+	req, err := http.NewRequest(http.MethodPatch, s.Gateway.URL+"/api/v1/accounts/unknown", strings.NewReader(`{"account":{"name":"renamed"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "user-token")
+	rsp, err := s.Gateway.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("PATCH /api/v1/accounts/unknown status = %d, want %d", rsp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServer_UpdateKeepsDeposits(t *testing.T) {
+	store := newTestStore(t)
+	s := newTestServer(t, store)
+	accounts := pb.NewAccountServiceClient(s.Conn)
+	transactions := pb.NewTransactionServiceClient(s.Conn)
+	ctx := withToken("user-token")
+	userID := "7d2d2a53-64a6-4b6c-b59c-2c0b6e26a3c1"
+
+	created, err := accounts.Create(ctx, &pb.CreateAccountRequest{Name: "main", Bank: pb.Bank_ACB, Balance: 10})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	id := created.GetAccount().GetId()
+
+	// deposit once the update has read the account
+	var armed int32
+	deposited := make(chan error, 1)
+	err = store.GetDatabase().Callback().Query().After("gorm:query").Register("test:deposit", func(db *gorm.DB) {
+		if db.Statement.Table != "accounts" || !atomic.CompareAndSwapInt32(&armed, 1, 0) {
+			return
+		}
+		go func() {
+			_, err := transactions.Create(ctx, &pb.CreateTransactionRequest{UserId: userID, AccountId: id, Amount: 5, TransactionType: pb.TransactionType_DEPOSIT})
+			deposited <- err
+		}()
+		// committed meanwhile unless the read locked the account
+		select {
+		case err := <-deposited:
+			deposited <- err
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rename := func() error {
+		_, err := accounts.Update(ctx, &pb.UpdateAccountRequest{
+			Account:    &pb.Account{Id: id, Name: "renamed"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		})
+		return err
+	}
+	atomic.StoreInt32(&armed, 1)
+	if err := rename(); err != nil {
+		// sqlite fails writes of a stale snapshot where postgres waits for the row lock
+		if err := rename(); err != nil {
+			t.Errorf("Update() error = %v", err)
+		}
+	}
+	if err := <-deposited; err != nil {
+		t.Fatalf("Create() deposit error = %v", err)
+	}
+
+	list, err := accounts.List(ctx, &pb.ListAccountsRequest{})
+	if err != nil || len(list.GetAccounts()) != 1 {
+		t.Fatalf("List() = %v, %v, want 1 account", list, err)
+	}
+	if got := list.GetAccounts()[0]; got.GetBalance() != 15 || got.GetName() != "renamed" {
+		t.Errorf("account = %v, want renamed w balance 15", got)
+	}
 }
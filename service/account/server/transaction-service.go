@@ -9,7 +9,7 @@ import (
 	errorSrv "account/error"
 	"account/model"
 
-	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
 	"github.com/google/uuid"
@@ -22,14 +22,15 @@ import (
 )
 
 type transactionServiceImpl struct {
-	dal        *postgres.DataAccessLayer
-	logger     log.Factory
+	dal    dal.DataAccessLayer
+	logger log.Factory
+	// balance updates are locked & fenced by account service
 	accountSrv *accountServiceImpl
 }
 
 var _ pb.TransactionServiceServer = (*transactionServiceImpl)(nil)
 
-func NewTransactionService(dal *postgres.DataAccessLayer, accountSrv *accountServiceImpl) pb.TransactionServiceServer {
+func NewTransactionService(dal dal.DataAccessLayer, accountSrv *accountServiceImpl) pb.TransactionServiceServer {
 	return &transactionServiceImpl{
 		dal:        dal,
 		accountSrv: accountSrv,
@@ -37,11 +38,22 @@ func NewTransactionService(dal *postgres.DataAccessLayer, accountSrv *accountSer
 	}
 }
 
+// lookupTransaction reads transaction in tx w/o account
+func (u *transactionServiceImpl) lookupTransaction(ctx context.Context, tx *gorm.DB, trans *model.Transaction) error {
+	if e := tx.Where(trans).First(trans).Error; e == gorm.ErrRecordNotFound {
+		return errorSrv.ErrTransactionNotFound
+	} else if e != nil {
+		u.logger.For(ctx).Error("Lookup trans", zap.Error(e))
+		return errorSrv.ErrConnectDB
+	}
+	return nil
+}
+
 // get user by id from redis & db
 func (u *transactionServiceImpl) getTransactionByID(ctx context.Context, trans *model.Transaction) error {
 	logger := u.logger.With(zap.String("id", trans.ID), zap.String("accountID", trans.AccountID)).For(ctx)
 	// get from cache
-	if e := trans.GetCache(); e != nil {
+	if e := trans.GetCache(ctx); e != nil {
 		logger.Error("Get trans cache", zap.Error(e))
 	} else {
 		return nil
@@ -55,7 +67,7 @@ func (u *transactionServiceImpl) getTransactionByID(ctx context.Context, trans *
 			return errorSrv.ErrConnectDB
 		}
 		// cache
-		if e := trans.Cache(); e != nil {
+		if e := trans.Cache(ctx); e != nil {
 			logger.Error("Cache trans", zap.Error(e))
 		}
 		return nil
@@ -144,48 +156,48 @@ func (u *transactionServiceImpl) Create(ctx context.Context, req *pb.CreateTrans
 
 	// response
 	rsp := &pb.CreateTransactionResponse{}
-	err := u.dal.GetDatabase().Transaction(func(tx *gorm.DB) error {
-		// lookup account
-		acc := &model.Account{ID: req.GetAccountId(), UserID: req.GetUserId()}
-		if err := u.accountSrv.getAccountByID(tx.Statement.Context, acc); err != nil {
-			return err
-		}
-		// check account balance
-		switch req.GetTransactionType() {
-		case pb.TransactionType_WITHDRAW:
-			acc.Balance -= req.GetAmount()
-			if acc.Balance < 0 {
-				return errorSrv.ErrInvalidWithdrawTransactionAmount
+	err := u.accountSrv.lockAccount(ctx, req.GetAccountId(), func(ctx context.Context, token int64) error {
+		return u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			acc := &model.Account{ID: req.GetAccountId(), UserID: req.GetUserId()}
+			if e := u.accountSrv.lookupAccount(ctx, tx, acc); e != nil {
+				return e
 			}
-		case pb.TransactionType_DEPOSIT:
-			acc.Balance += req.GetAmount()
-		case pb.TransactionType_UNKNOW:
-			return errorSrv.ErrUnknowTypeTransaction
-		}
-		// create transaction
-		trans := &model.Transaction{
-			ID:              uuid.New().String(),
-			AccountID:       req.GetAccountId(),
-			TransactionType: req.GetTransactionType().String(),
-			Amount:          req.GetAmount(),
-			Account:         *acc,
-		}
-		if err := trans.Validate(); err != nil {
-			u.logger.For(ctx).Error("Validate trans", zap.Error(err), zap.Any("details", status.Convert(err).Details()))
-			return err
-		}
-		if err := tx.Omit("Account").Create(trans).Error; err != nil {
-			u.logger.For(ctx).Error("Create trans", zap.Any("data", trans), zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		// update account balance
-		if err := tx.Select("Balance").Save(&acc).Error; err != nil {
-			u.logger.For(ctx).Error("Update account balance", zap.Any("data", acc), zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		//
-		rsp.Transaction = trans.Transform2GRPC()
-		return nil
+			// check account balance
+			switch req.GetTransactionType() {
+			case pb.TransactionType_WITHDRAW:
+				acc.Balance -= req.GetAmount()
+				if acc.Balance < 0 {
+					return errorSrv.ErrInvalidWithdrawTransactionAmount
+				}
+			case pb.TransactionType_DEPOSIT:
+				acc.Balance += req.GetAmount()
+			case pb.TransactionType_UNKNOW:
+				return errorSrv.ErrUnknowTypeTransaction
+			}
+			// create transaction
+			trans := &model.Transaction{
+				ID:              uuid.New().String(),
+				AccountID:       req.GetAccountId(),
+				TransactionType: req.GetTransactionType().String(),
+				Amount:          req.GetAmount(),
+				Account:         *acc,
+			}
+			if err := trans.Validate(); err != nil {
+				u.logger.For(ctx).Error("Validate trans", zap.Error(err), zap.Any("details", status.Convert(err).Details()))
+				return err
+			}
+			if err := tx.Omit("Account").Create(trans).Error; err != nil {
+				u.logger.For(ctx).Error("Create trans", zap.Any("data", trans), zap.Error(err))
+				return errorSrv.ErrConnectDB
+			}
+			// update account balance
+			if err := u.accountSrv.saveBalance(ctx, tx, acc, token); err != nil {
+				return err
+			}
+			//
+			rsp.Transaction = trans.Transform2GRPC()
+			return nil
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -202,31 +214,37 @@ func (u *transactionServiceImpl) Delete(ctx context.Context, req *pb.DeleteTrans
 	if req.GetId() == nil {
 		return nil, errorSrv.ErrMissingTransactionID
 	}
-	err := u.dal.GetDatabase().Transaction(func(tx *gorm.DB) error {
-		trans := &model.Transaction{ID: req.GetId().Value}
-		if err := u.getTransactionByID(tx.Statement.Context, trans); err != nil {
-			return err
-		}
-		// delete transaction
-		if err := tx.Delete(trans).Error; err != nil {
-			u.logger.For(ctx).Error("Delete transaction", zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		// increase account balance
-		account := trans.Account
-		switch trans.TransactionType {
-		case pb.TransactionType_WITHDRAW.String():
-			account.Balance += trans.Amount
-		case pb.TransactionType_DEPOSIT.String():
-			account.Balance -= trans.Amount
-		case pb.TransactionType_UNKNOW.String():
-			return errorSrv.ErrUnknowTypeTransaction
-		}
-		if err := tx.Select("Balance").Save(&account).Error; err != nil {
-			u.logger.For(ctx).Error("Update account balance", zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		return nil
+	// account to lock
+	trans := &model.Transaction{ID: req.GetId().Value}
+	if err := u.getTransactionByID(ctx, trans); err != nil {
+		return nil, err
+	}
+	err := u.accountSrv.lockAccount(ctx, trans.AccountID, func(ctx context.Context, token int64) error {
+		return u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			trans := &model.Transaction{ID: trans.ID, AccountID: trans.AccountID}
+			if err := u.lookupTransaction(ctx, tx, trans); err != nil {
+				return err
+			}
+			account := &model.Account{ID: trans.AccountID}
+			if err := u.accountSrv.lookupAccount(ctx, tx, account); err != nil {
+				return err
+			}
+			// delete transaction
+			if err := tx.Delete(trans).Error; err != nil {
+				u.logger.For(ctx).Error("Delete transaction", zap.Error(err))
+				return errorSrv.ErrConnectDB
+			}
+			// increase account balance
+			switch trans.TransactionType {
+			case pb.TransactionType_WITHDRAW.String():
+				account.Balance += trans.Amount
+			case pb.TransactionType_DEPOSIT.String():
+				account.Balance -= trans.Amount
+			case pb.TransactionType_UNKNOW.String():
+				return errorSrv.ErrUnknowTypeTransaction
+			}
+			return u.accountSrv.saveBalance(ctx, tx, account, token)
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -246,70 +264,75 @@ func (u *transactionServiceImpl) Update(ctx context.Context, req *pb.UpdateTrans
 	}
 
 	rsp := &pb.UpdateTransactionResponse{}
-	err := u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		trans := &model.Transaction{
-			AccountID: req.GetTransaction().GetAccountId(),
-			ID:        req.GetTransaction().GetId(),
-		}
-		// find trans
-		if e := u.getTransactionByID(tx.Statement.Context, trans); e != nil {
-			return e
-		}
-		u.logger.For(ctx).Info("mask", zap.Strings("path", req.GetUpdateMask().GetPaths()))
-		// If there is no update mask do a regular update
-		var paths []string
-		if req.GetUpdateMask() == nil || len(req.GetUpdateMask().GetPaths()) == 0 {
-			paths = []string{"amount"}
-		} else {
-			paths = req.GetUpdateMask().GetPaths()
-		}
-		for _, path := range paths {
-			switch path {
-			case "id":
-				return errorSrv.ErrUpdateTransactionID
-			case "account_id":
-				return errorSrv.ErrUpdateTransactionAccountID
-			case "user_id":
-				return errorSrv.ErrUpdateTransactionUserID
-			case "transaction_type":
-				return errorSrv.ErrUpdateTransactionType
-			case "amount":
-				switch trans.TransactionType {
-				case pb.TransactionType_WITHDRAW.String():
-					trans.Account.Balance += trans.Amount - req.GetTransaction().GetAmount()
-				case pb.TransactionType_DEPOSIT.String():
-					trans.Account.Balance += -trans.Amount + req.GetTransaction().GetAmount()
-				case pb.TransactionType_UNKNOW.String():
-					return errorSrv.ErrUnknowTypeTransaction
-				}
-				if trans.Account.Balance < 0 {
-					return errorSrv.ErrInvalidTransactionAmount
+	err := u.accountSrv.lockAccount(ctx, req.GetTransaction().GetAccountId(), func(ctx context.Context, token int64) error {
+		return u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			trans := &model.Transaction{
+				AccountID: req.GetTransaction().GetAccountId(),
+				ID:        req.GetTransaction().GetId(),
+			}
+			// find trans & account in tx: cached amount & balance may be stale
+			if e := u.lookupTransaction(ctx, tx, trans); e != nil {
+				return e
+			}
+			trans.Account = model.Account{ID: trans.AccountID}
+			if e := u.accountSrv.lookupAccount(ctx, tx, &trans.Account); e != nil {
+				return e
+			}
+			u.logger.For(ctx).Info("mask", zap.Strings("path", req.GetUpdateMask().GetPaths()))
+			// If there is no update mask do a regular update
+			var paths []string
+			if req.GetUpdateMask() == nil || len(req.GetUpdateMask().GetPaths()) == 0 {
+				paths = []string{"amount"}
+			} else {
+				paths = req.GetUpdateMask().GetPaths()
+			}
+			for _, path := range paths {
+				switch path {
+				case "id":
+					return errorSrv.ErrUpdateTransactionID
+				case "account_id":
+					return errorSrv.ErrUpdateTransactionAccountID
+				case "user_id":
+					return errorSrv.ErrUpdateTransactionUserID
+				case "transaction_type":
+					return errorSrv.ErrUpdateTransactionType
+				case "amount":
+					switch trans.TransactionType {
+					case pb.TransactionType_WITHDRAW.String():
+						trans.Account.Balance += trans.Amount - req.GetTransaction().GetAmount()
+					case pb.TransactionType_DEPOSIT.String():
+						trans.Account.Balance += -trans.Amount + req.GetTransaction().GetAmount()
+					case pb.TransactionType_UNKNOW.String():
+						return errorSrv.ErrUnknowTypeTransaction
+					}
+					if trans.Account.Balance < 0 {
+						return errorSrv.ErrInvalidTransactionAmount
+					}
+					trans.Amount = req.GetTransaction().GetAmount()
+				default:
+					return errors.BadRequest("invalid field specified", map[string]string{
+						"update_mask": fmt.Sprintf("account does not have field %q", path),
+					})
 				}
-				trans.Amount = req.GetTransaction().GetAmount()
-			default:
-				return errors.BadRequest("invalid field specified", map[string]string{
-					"update_mask": fmt.Sprintf("account does not have field %q", path),
-				})
 			}
-		}
-		if err := trans.Validate(); err != nil {
-			u.logger.For(ctx).Error("Validate trans", zap.Error(err))
-			return err
-		}
-		// update trans
-		if err := tx.Select("Amount").Save(trans).Error; err != nil {
-			u.logger.For(ctx).Error("Update trans", zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		// update account balance
-		if err := tx.Select("Balance").Save(&trans.Account).Error; err != nil {
-			u.logger.For(ctx).Error("Update account", zap.Error(err))
-			return errorSrv.ErrConnectDB
-		}
-		// response
-		rsp.Transaction = trans.Transform2GRPC()
-		rsp.Transaction.UpdatedAt = timestamppb.New(trans.UpdatedAt)
-		return nil
+			if err := trans.Validate(); err != nil {
+				u.logger.For(ctx).Error("Validate trans", zap.Error(err))
+				return err
+			}
+			// update trans
+			if err := tx.Select("Amount").Save(trans).Error; err != nil {
+				u.logger.For(ctx).Error("Update trans", zap.Error(err))
+				return errorSrv.ErrConnectDB
+			}
+			// update account balance
+			if err := u.accountSrv.saveBalance(ctx, tx, &trans.Account, token); err != nil {
+				return err
+			}
+			// response
+			rsp.Transaction = trans.Transform2GRPC()
+			rsp.Transaction.UpdatedAt = timestamppb.New(trans.UpdatedAt)
+			return nil
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -52,7 +52,7 @@ func TestNewTransactionService(t *testing.T) {
 			dal := tt.caller(t)
 			if !tt.wantErr {
 				require.NotNil(t, dal)
-				u := NewAccountService(dal)
+				u := NewAccountService(dal, nil)
 				require.NotNil(t, u)
 			} else {
 				require.Nil(t, dal)
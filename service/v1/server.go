@@ -99,8 +99,15 @@ func (s *Server) Run() error {
 	}
 	defer dal.Disconnect()
 
+	// todo service runs raw sql
+	db, err := dal.GetDatabase().DB()
+	if err != nil {
+		s.logger.For(ctx).Fatal("Get sql db failed", zap.Error(err))
+		return err
+	}
+
 	// implement service
-	api := NewToDoServiceServer(s.config.Version, dal.GetDatabase(), s.logger)
+	api := NewToDoServiceServer(s.config.Version, db, s.logger)
 	// register impl service
 	api_v1.RegisterToDoServiceServer(s.server, api)
 
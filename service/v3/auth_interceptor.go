@@ -45,51 +45,51 @@ func (a *AuthServerInterceptor) Stream() grpc.StreamServerInterceptor {
 	return a.StreamInterceptor
 }
 
-func (a *AuthServerInterceptor) authorize(ctx context.Context, method string, req interface{}) error {
+func (a *AuthServerInterceptor) authorize(ctx context.Context, method string, req interface{}) (*UserClaims, error) {
 	authReq, ok := a.authRequiredMethods[method]
 	if !authReq || !ok {
-		return nil
+		return nil, nil
 	}
 
 	// fetch authorization header
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(codes.DataLoss, "failed to get metadata")
+		return nil, status.Errorf(codes.DataLoss, "failed to get metadata")
 	}
 	accessToken := md.Get("authorization")
 	if len(accessToken) == 0 {
-		return status.Errorf(codes.InvalidArgument, "missing 'authorization' header")
+		return nil, status.Errorf(codes.InvalidArgument, "missing 'authorization' header")
 	}
 	if strings.Trim(accessToken[0], " ") == "" {
-		return status.Errorf(codes.InvalidArgument, "empty 'authorization' header")
+		return nil, status.Errorf(codes.InvalidArgument, "empty 'authorization' header")
 	}
 	a.Log().For(ctx).Info("authorize", zap.String("token", accessToken[0]))
 
 	// verify token
 	userClaims, err := a.jwtManager.Verify(accessToken[0])
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "verify failed: %v", err)
+		return nil, status.Errorf(codes.Unauthenticated, "verify failed: %v", err)
 	}
 
 	// invalidate token
 	if invalidate, _ := a.jwtManager.IsInvalidated(userClaims.ID, userClaims.Id); invalidate {
-		return status.Errorf(codes.Unauthenticated, "invalidated token")
+		return nil, status.Errorf(codes.Unauthenticated, "invalidated token")
 	}
 
 	// root full access
 	if strings.ToLower(userClaims.Role) == api_v3.Role_ROOT.String() {
-		return nil
+		return userClaims, nil
 	}
 
 	// check accessiable method with user role got from header authorization
 	accessibleRoles, ok := a.accessibleRoles[method]
 	if !ok {
-		return nil
+		return userClaims, nil
 	}
 	// check accessible role for method
 	for _, role := range accessibleRoles {
 		if role == strings.ToLower(userClaims.Role) {
-			return nil
+			return userClaims, nil
 		}
 	}
 
@@ -97,11 +97,11 @@ func (a *AuthServerInterceptor) authorize(ctx context.Context, method string, re
 	switch method {
 	case "/api_v3.UserService/Update":
 		if msg, ok := req.(*api_v3.UpdateUserRequest); ok && msg.GetUser().GetId() == userClaims.ID {
-			return nil
+			return userClaims, nil
 		}
 	case "/api_v3.UserService/Delete":
 		if msg, ok := req.(*api_v3.DeleteUserRequest); ok && msg.GetId() == userClaims.ID {
-			return nil
+			return userClaims, nil
 		}
 	}
 
@@ -109,13 +109,13 @@ func (a *AuthServerInterceptor) authorize(ctx context.Context, method string, re
 	xreqid := md.Get("x-request-id")
 	a.Log().For(ctx).Info("request", zap.String("x-request-id", xreqid[0]))
 
-	ctx = utils.SetContextValue(ctx, "userClaims.ID", userClaims.ID)
-	userID, ok := utils.GetContextValue(ctx, "userClaims.ID")
+	ctx = utils.SetContextValue(ctx, utils.UserIDContextKey, userClaims.ID)
+	userID, ok := utils.GetContextValue(ctx, utils.UserIDContextKey)
 	a.Log().Info("ctx token", zap.String("userID", userID), zap.Bool("ok", ok))
 
 	// validate request
 	// log.Println("[gRPC server] validate req")
-	return status.Errorf(codes.PermissionDenied, "no permission to access this method: %s with [username:%s, role:%s]", method, userClaims.Username, userClaims.Role)
+	return nil, status.Errorf(codes.PermissionDenied, "no permission to access this method: %s with [username:%s, role:%s]", method, userClaims.Username, userClaims.Role)
 }
 
 // unary request to grpc server
@@ -129,10 +129,13 @@ func (a *AuthServerInterceptor) UnaryInterceptor(ctx context.Context, req interf
 	a.Log().For(ctx).Info("unary req", zap.String("method", info.FullMethod))
 
 	// authorize request
-	err = a.authorize(ctx, info.FullMethod, req)
+	userClaims, err := a.authorize(ctx, info.FullMethod, req)
 	if err != nil {
 		return nil, err
 	}
+	if userClaims != nil {
+		ctx = utils.SetContextValue(ctx, utils.UserIDContextKey, userClaims.ID)
+	}
 
 	// NOT WORK: because server service does NOT using context to send anything
 	ctx = metadata.AppendToOutgoingContext(ctx, []string{"x-response-id", "a"}...)
@@ -164,10 +167,13 @@ func (a *AuthServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.Serve
 	}()
 	a.Log().For(ss.Context()).Info("stream req", zap.String("method", info.FullMethod), zap.Any("serverStream", info.IsServerStream))
 
-	err = a.authorize(ss.Context(), info.FullMethod, nil)
+	userClaims, err := a.authorize(ss.Context(), info.FullMethod, nil)
 	if err != nil {
 		return err
 	}
+	if userClaims != nil {
+		ss = interceptor.WrapServerStream(utils.SetContextValue(ss.Context(), utils.UserIDContextKey, userClaims.ID), ss)
+	}
 
 	// send x-response-id header
 	header := metadata.New(map[string]string{
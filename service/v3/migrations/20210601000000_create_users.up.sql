@@ -0,0 +1,15 @@
+-- if not exists: adopts schemas created by gorm AutoMigrate
+CREATE TABLE IF NOT EXISTS users (
+	id text NOT NULL,
+	username text,
+	fullname text,
+	active boolean,
+	password text,
+	email text,
+	verify_token text,
+	role text,
+	created_at timestamptz,
+	updated_at timestamptz,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
@@ -0,0 +1,9 @@
+// Package migrations embeds sql migrations of the user service
+package migrations
+
+import "embed"
+
+// FS holds <version>_<name>.up.sql & .down.sql files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -1,12 +1,12 @@
 package model
 
 import (
-	"encoding/json"
+	"context"
 	"strings"
 	"time"
 
 	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 	"github.com/1412335/grpc-rest-microservice/pkg/utils"
 	errorSrv "github.com/1412335/grpc-rest-microservice/service/v3/error"
@@ -21,7 +21,7 @@ type User struct {
 	Username    string `validate:"nonzero,regexp=^[a-zA-Z0-9_]*$"`
 	Fullname    string `validate:"nonzero,max=100"`
 	Active      bool
-	Password    string `json:"-" validate:"min=8"`
+	Password    string `json:"-" msgpack:"-" validate:"min=8"`
 	Email       string `gorm:"uniqueIndex" validate:"nonzero"`
 	VerifyToken string
 	Role        string
@@ -56,23 +56,22 @@ func (u *User) UpdateFromGRPC(user *api_v3.User) {
 	}
 }
 
-func (u *User) GetCache() error {
-	var bytes []byte
-	if err := cache.Get(u.ID, &bytes); err == cache.ErrCacheNotAvailable {
+// UserTag tags cache entries owned by user
+func UserTag(userID string) string {
+	return "user:" + userID
+}
+
+func (u *User) GetCache(ctx context.Context) error {
+	if err := cache.Get(ctx, u.ID, u); err == cache.ErrCacheNotAvailable {
 		return nil
 	} else if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(bytes, u); err != nil {
-		return err
-	}
 	return nil
 }
 
-func (u *User) Cache() error {
-	if bytes, err := json.Marshal(u); err != nil {
-		return err
-	} else if err := cache.Set(u.ID, string(bytes)); err == cache.ErrCacheNotAvailable {
+func (u *User) Cache(ctx context.Context) error {
+	if err := cache.Set(ctx, u.ID, u, 0, UserTag(u.ID)); err == cache.ErrCacheNotAvailable {
 		return nil
 	} else if err != nil {
 		return err
@@ -80,8 +79,14 @@ func (u *User) Cache() error {
 	return nil
 }
 
-func (u *User) DelCache() error {
-	if err := cache.Delete(u.ID); err == cache.ErrCacheNotAvailable {
+// DelCache removes user & every entry tagged w user
+func (u *User) DelCache(ctx context.Context) error {
+	if err := cache.Delete(ctx, u.ID); err == cache.ErrCacheNotAvailable {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := cache.InvalidateTag(ctx, UserTag(u.ID)); err == cache.ErrCacheNotAvailable {
 		return nil
 	} else if err != nil {
 		return err
@@ -134,7 +139,7 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 
 func (u *User) AfterCreate(tx *gorm.DB) error {
 	// cache user
-	if err := u.Cache(); err != nil {
+	if err := u.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -157,7 +162,7 @@ func (u *User) AfterUpdate(tx *gorm.DB) error {
 		return errorSrv.ErrConnectDB
 	}
 	// cache user
-	if err := u.Cache(); err != nil {
+	if err := u.Cache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
@@ -173,7 +178,7 @@ func (u *User) BeforeDelete(tx *gorm.DB) error {
 
 func (u *User) AfterDelete(tx *gorm.DB) error {
 	// rm cache user
-	if err := u.DelCache(); err != nil {
+	if err := u.DelCache(tx.Statement.Context); err != nil {
 		return err
 	}
 	return nil
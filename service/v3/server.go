@@ -4,11 +4,13 @@ import (
 	"context"
 
 	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
-	"github.com/1412335/grpc-rest-microservice/pkg/cache"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
 	"github.com/1412335/grpc-rest-microservice/pkg/configs"
-	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/redis"
+	interceptor "github.com/1412335/grpc-rest-microservice/pkg/interceptor/server"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
+	"github.com/1412335/grpc-rest-microservice/pkg/ratelimit"
 	"github.com/1412335/grpc-rest-microservice/pkg/server"
 	"github.com/1412335/grpc-rest-microservice/service/v3/model"
 
@@ -19,45 +21,53 @@ import (
 type Server struct {
 	server   *server.Server
 	tokenSrv *TokenService
-	dal      *postgres.DataAccessLayer
+	dal      dal.DataAccessLayer
 }
 
 func NewServer(srvConfig *configs.ServiceConfig, opt ...server.Option) *Server {
-	// init postgres
-	dal, err := postgres.NewDataAccessLayer(context.Background(), srvConfig.Database)
-	if err != nil || dal.GetDatabase() == nil {
+	// init db: postgres, mysql or sqlite
+	store, err := dal.NewDataAccessLayer(context.Background(), srvConfig.Database)
+	if err != nil || store.GetDatabase() == nil {
 		log.Error("init db failed", zap.Error(err))
 		return nil
 	}
-	// migrate db
-	if err = dal.GetDatabase().AutoMigrate(
-		&model.User{},
-	); err != nil {
-		log.Error("migrate db failed", zap.Error(err))
-		return nil
+	// dev only: schema is migrated by `migrate up`
+	if srvConfig.Database.AutoMigrate {
+		if err = store.GetDatabase().AutoMigrate(
+			&model.User{},
+		); err != nil {
+			log.Error("migrate db failed", zap.Error(err))
+			return nil
+		}
 	}
 
 	// connect redis
-	redisStore, err := redis.New(redis.WithNodes(srvConfig.Redis.Nodes), redis.WithPrefix(srvConfig.ServiceName))
+	redisStore, err := redis.New(redis.WithConfig(srvConfig.Redis), redis.WithPrefix(srvConfig.ServiceName))
 	if err != nil {
 		log.Error("connect redis store failed", zap.Error(err))
-	} else if redisStore != nil {
-		// cache w redis store
-		cache.DefaultCache, err = cache.NewRedisCache(redisStore, cache.WithPrefix(srvConfig.ServiceName))
-		if err != nil {
-			log.Error("create cache redis store failed", zap.Error(err))
-		}
+	}
+
+	// cache w redis store, in memory or both (tiered)
+	cache.DefaultCache, err = cache.New(srvConfig.Cache, redisStore, cache.WithPrefix(srvConfig.ServiceName))
+	if err != nil {
+		log.Error("create cache failed", zap.Error(err))
 	}
 
 	// create server
 	srv := &Server{
 		tokenSrv: NewTokenService(srvConfig.JWT, redisStore),
-		dal:      dal,
+		dal:      store,
 	}
 
 	// auth server interceptor
 	authInterceptor := NewAuthServerInterceptor(srv.tokenSrv, srvConfig.AuthRequiredMethods, srvConfig.AccessibleRoles)
 
+	// health probes for dependencies
+	opt = append(opt, server.WithHealthCheck("postgres", store.Ping))
+	if redisStore != nil {
+		opt = append(opt, server.WithHealthCheck("redis", redisStore.Ping))
+	}
+
 	// append server options with logger + auth token interceptor
 	opt = append(opt,
 		server.WithInterceptors(
@@ -66,6 +76,17 @@ func NewServer(srvConfig *configs.ServiceConfig, opt ...server.Option) *Server {
 		),
 	)
 
+	// rate limiting after auth (limits keyed by user id), shared across replicas w redis
+	if len(srvConfig.RateLimits) > 0 {
+		limiter := ratelimit.NewMemoryLimiter()
+		if redisStore != nil {
+			limiter = ratelimit.NewRedisLimiter(redisStore)
+		}
+		opt = append(opt, server.WithInterceptors(
+			interceptor.NewRateLimitServerInterceptor(limiter, srvConfig.RateLimits),
+		))
+	}
+
 	// grpc server
 	s := server.NewServer(srvConfig, opt...)
 
@@ -0,0 +1,116 @@
+package v3
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
+	"github.com/1412335/grpc-rest-microservice/pkg/configs"
+	"github.com/1412335/grpc-rest-microservice/pkg/server"
+	"github.com/1412335/grpc-rest-microservice/pkg/servertest"
+	"github.com/1412335/grpc-rest-microservice/service/v3/model"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// auth interceptor & error mapping end-to-end, rejected requests never reach db
+func TestServer_Auth(t *testing.T) {
+	config := &configs.ServiceConfig{
+		ServiceName: "user",
+		Version:     "v3",
+		JWT: &configs.JWT{
+			Issuer:    "test",
+			SecretKey: "test",
+			Duration:  time.Minute,
+		},
+		AuthRequiredMethods: map[string]bool{
+			"/api_v3.UserService/List": true,
+		},
+		AccessibleRoles: map[string][]string{
+			"/api_v3.UserService/List": {"admin"},
+		},
+	}
+	tokenSrv := NewTokenService(config.JWT, nil)
+
+	s, err := servertest.New(config, func(srv *grpc.Server) error {
+		api_v3.RegisterUserServiceServer(srv, NewUserService(nil, tokenSrv))
+		return nil
+	},
+		servertest.WithServerOptions(server.WithInterceptors(
+			NewAuthServerInterceptor(tokenSrv, config.AuthRequiredMethods, config.AccessibleRoles),
+		)),
+		servertest.WithGateway(api_v3.RegisterUserServiceHandlerFromEndpoint),
+	)
+	if err != nil {
+		t.Fatalf("servertest.New() error = %v", err)
+	}
+	defer s.Close()
+
+	userToken, err := tokenSrv.Generate(&model.User{ID: "1", Username: "user", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantCode   codes.Code
+		wantStatus int
+	}{
+		{
+			name:       "missing token",
+			wantCode:   codes.InvalidArgument,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid token",
+			token:      "invalid",
+			wantCode:   codes.Unauthenticated,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no permission",
+			token:      userToken,
+			wantCode:   codes.PermissionDenied,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	client := api_v3.NewUserServiceClient(s.Conn)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// grpc
+			md := metadata.Pairs("x-request-id", tt.name)
+			if tt.token != "" {
+				md.Set("authorization", tt.token)
+			}
+			ctx := metadata.NewOutgoingContext(context.Background(), md)
+			_, err := client.List(ctx, &api_v3.ListUsersRequest{})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("List() code = %v, want %v", got, tt.wantCode)
+			}
+
+			// gateway
+			req, err := http.NewRequest(http.MethodGet, s.Gateway.URL+"/api/v3/users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Request-Id", tt.name)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /api/v3/users error = %v", err)
+			}
+			rsp.Body.Close()
+			if rsp.StatusCode != tt.wantStatus {
+				t.Errorf("GET /api/v3/users status = %d, want %d", rsp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
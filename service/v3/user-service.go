@@ -17,6 +17,8 @@ import (
 	"gorm.io/gorm"
 
 	api_v3 "github.com/1412335/grpc-rest-microservice/pkg/api/v3"
+	"github.com/1412335/grpc-rest-microservice/pkg/cache/v2"
+	"github.com/1412335/grpc-rest-microservice/pkg/dal"
 	"github.com/1412335/grpc-rest-microservice/pkg/dal/postgres"
 	"github.com/1412335/grpc-rest-microservice/pkg/errors"
 	"github.com/1412335/grpc-rest-microservice/pkg/log"
@@ -26,14 +28,14 @@ import (
 )
 
 type userServiceImpl struct {
-	dal      *postgres.DataAccessLayer
+	dal      dal.DataAccessLayer
 	logger   log.Factory
 	tokenSrv *TokenService
 }
 
 var _ api_v3.UserServiceServer = (*userServiceImpl)(nil)
 
-func NewUserService(dal *postgres.DataAccessLayer, tokenSrv *TokenService) api_v3.UserServiceServer {
+func NewUserService(dal dal.DataAccessLayer, tokenSrv *TokenService) api_v3.UserServiceServer {
 	return &userServiceImpl{
 		dal:      dal,
 		logger:   log.With(zap.String("srv", "user")),
@@ -41,33 +43,26 @@ func NewUserService(dal *postgres.DataAccessLayer, tokenSrv *TokenService) api_v
 	}
 }
 
-// get user by id from redis & db
+// get user by id from cache or db, concurrent misses share one query
 func (u *userServiceImpl) getUserByID(ctx context.Context, id string) (*model.User, error) {
-	user := &model.User{ID: id}
-	// get from cache
-	if e := user.GetCache(); e != nil {
-		u.logger.For(ctx).Error("Get user cache", zap.Error(e))
-	} else {
-		return user, nil
-	}
-	err := u.dal.GetDatabase().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// find user by id
-		if e := tx.Where(&model.User{ID: id}).First(user).Error; e == gorm.ErrRecordNotFound {
-			return errorSrv.ErrUserNotFound
+	user := &model.User{}
+	err := cache.GetOrLoad(ctx, id, 0, user, func(ctx context.Context) (interface{}, error) {
+		user := &model.User{}
+		// primary: lagging replica would be cached until ttl
+		if e := u.dal.GetDatabase().WithContext(postgres.WithPrimary(ctx)).Where(&model.User{ID: id}).First(user).Error; e == gorm.ErrRecordNotFound {
+			return nil, cache.ErrNotFound
 		} else if e != nil {
 			u.logger.For(ctx).Error("Find user", zap.Error(e))
-			return errorSrv.ErrConnectDB
+			return nil, errorSrv.ErrConnectDB
 		}
-		// cache
-		if e := user.Cache(); e != nil {
-			u.logger.For(ctx).Error("Cache user", zap.Error(e))
-		}
-		return nil
-	})
-	if err != nil {
+		return user, nil
+	}, model.UserTag(id))
+	if err == cache.ErrNotFound {
+		return nil, errorSrv.ErrUserNotFound
+	} else if err != nil {
 		return nil, err
 	}
-	return user, err
+	return user, nil
 }
 
 // create user & token
@@ -352,7 +347,7 @@ func (u *userServiceImpl) Login(ctx context.Context, req *api_v3.LoginRequest) (
 			return errorSrv.ErrTokenGenerated
 		}
 		// cache user
-		if e := user.Cache(); e != nil {
+		if e := user.Cache(ctx); e != nil {
 			u.logger.For(ctx).Error("Cache user", zap.Error(e))
 		}
 		//
@@ -371,7 +366,7 @@ func (u *userServiceImpl) Logout(ctx context.Context, req *api_v3.LogoutRequest)
 	if len(req.GetId()) == 0 {
 		return nil, errorSrv.ErrMissingUserID
 	}
-	if err := (&model.User{ID: req.GetId()}).DelCache(); err != nil {
+	if err := (&model.User{ID: req.GetId()}).DelCache(ctx); err != nil {
 		u.logger.For(ctx).Error("clear cache", zap.Error(err))
 		return nil, errors.InternalServerError("logout", "clear cache failed")
 	}